@@ -16,12 +16,20 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/cldmnky/dev-tool/pkg/config"
 	"github.com/cldmnky/dev-tool/pkg/git"
 	"github.com/cldmnky/dev-tool/pkg/image"
+	"github.com/cldmnky/dev-tool/pkg/registry"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // buildCmd represents the build command
@@ -30,18 +38,60 @@ var buildCmd = &cobra.Command{
 	Short: "Build a docker image",
 	Long:  `Build  docker image.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		// Get the current commit
-		rev, err := git.GetCommit(".")
-		if err != nil {
-			log.Fatalf("Error getting commit: %s", err)
-		}
-		err = image.BuildImage("Dockerfile", ".", fmt.Sprintf("imagename:%s", rev))
-		if err != nil {
-			log.Fatalf("build error - %s", err)
+		if err := runBuild(cmd); err != nil {
+			log.Fatal(err)
 		}
 	},
 }
 
+// runBuild builds the image, or all services with --all. Errors are returned
+// so that the checkout of --ref is removed before exiting.
+func runBuild(cmd *cobra.Command) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("Unknown output format: %s", output)
+	}
+	all, _ := cmd.Flags().GetBool("all")
+	changed, _ := cmd.Flags().GetBool("changed")
+	info, cleanup, err := getBuildInfo(cmd)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	// read after getBuildInfo, the config of --ref is the one of the checkout
+	config := getConfig()
+	ctx, cancel := signalContext()
+	defer cancel()
+	if all || changed {
+		return buildAll(ctx, cmd, config, info, output)
+	}
+	refs, err := imageReferences(cmd, &config.Repo, info)
+	if err != nil {
+		return fmt.Errorf("Error getting image name: %s", err)
+	}
+	fmt.Fprintf(os.Stderr, "Tagging policy: %s\n", image.DescribePolicy(&config.Repo.Tags))
+	for _, ref := range refs {
+		fmt.Fprintf(os.Stderr, "  %s\n", ref)
+	}
+	buildOpts, err := getBuildOptions(cmd, &config.Repo.Build)
+	if err != nil {
+		return fmt.Errorf("Error parsing build options: %s", err)
+	}
+	buildOpts.Tags = refs
+	buildOpts.Git = info
+	buildOpts.Output = os.Stderr
+	builder, err := getBuilder(cmd, config, &config.Repo.Build)
+	if err != nil {
+		return err
+	}
+	push, _ := cmd.Flags().GetBool("push")
+	result, err := buildAndPush(ctx, cmd, builder, &config.Repo, config.Registries, refs, info, buildOpts, push)
+	if err != nil {
+		return err
+	}
+	return result.Print(os.Stdout, output)
+}
+
 func init() {
 	imageCmd.AddCommand(buildCmd)
 
@@ -54,4 +104,346 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// buildCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	buildCmd.Flags().Bool("push", false, "Push the image after a successful build")
+	buildCmd.Flags().Bool("all", false, "Build all services of the repo in dependency order")
+	buildCmd.Flags().Int("parallel", defaultParallel, "Number of services built at the same time with --all")
+	buildCmd.Flags().String("ref", "", "Build a git tag, branch or sha from a clean export instead of the worktree")
+	buildCmd.Flags().Bool("changed", false, "Only build the services affected by changes since --base, implies --all")
+	buildCmd.Flags().String("base", "", "Revision to detect changes from (default is the merge-base with the default branch)")
+	buildCmd.Flags().StringP("output", "o", "text", "Output format of the build result, text or json")
+	addBuildFlags(buildCmd.Flags())
+}
+
+// addBuildFlags adds the flags that control how an image is built and pushed,
+// shared by image build and deploy
+func addBuildFlags(flags *pflag.FlagSet) {
+	flags.Duration("timeout", defaultTimeout, "Timeout for the build")
+	flags.Duration("push-timeout", defaultTimeout, "Timeout for the push")
+	flags.Bool("skip-existing", false, "Skip the build when the image for the commit exists locally or in the registry")
+	flags.Bool("retag-existing", false, "Add the new tags to an existing image in the registry, implies --skip-existing")
+	flags.Bool("skip-lint", false, "Do not lint the Dockerfile before building")
+	flags.StringArray("build-arg", []string{}, "Set build-time variables, KEY=VAL or KEY to use the environment")
+	flags.StringArray("label", []string{}, "Set metadata on the image, KEY=VAL")
+	flags.String("target", "", "Set the target build stage to build")
+	flags.StringP("file", "f", "", "Path to the Dockerfile (default is Dockerfile in the build context)")
+	flags.String("context", "", "Path to the build context (default \".\")")
+	flags.Bool("no-cache", false, "Do not use cache when building the image")
+	flags.Bool("pull", false, "Always attempt to pull a newer version of the base images")
+	flags.String("network", "", "Networking mode for the RUN instructions during build")
+	flags.Bool("no-oci-labels", false, "Do not stamp the OCI standard labels from git metadata")
+	flags.Bool("reproducible", false, "Normalize file times and ownership of the build context and report its digest")
+	flags.String("sbom", "", "Write a software bill of materials of the image, spdx or cyclonedx")
+	flags.String("sbom-dir", ".", "Directory the SBOM is written to")
+	flags.Bool("sbom-attach", false, "Attach the SBOM to the pushed image in the registry, requires --push")
+}
+
+// getBuildInfo returns the git metadata to tag the build with. With --ref the
+// revision is exported to a temporary directory which becomes the working
+// directory and the config is read again with the repo config of the
+// revision, cleanup removes it.
+func getBuildInfo(cmd *cobra.Command) (*git.Info, func(), error) {
+	ref, _ := cmd.Flags().GetString("ref")
+	if ref == "" {
+		info, err := git.GetInfo(".")
+		if err != nil {
+			return nil, nil, fmt.Errorf("Error getting git info: %s", err)
+		}
+		return info, func() {}, nil
+	}
+	if changed, _ := cmd.Flags().GetBool("changed"); changed {
+		return nil, nil, fmt.Errorf("--changed can not be used with --ref")
+	}
+	root, err := git.Root(".")
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error getting git info: %s", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, nil, err
+	}
+	rel, err := filepath.Rel(root, wd)
+	if err != nil {
+		return nil, nil, err
+	}
+	absolutePathFlags(cmd, wd, "sbom-dir", "oci-output")
+	checkout, err := git.CheckoutRevision(".", ref)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error checking out %s: %s", ref, err)
+	}
+	fmt.Fprintf(os.Stderr, "Building %s (%s) from %s\n", ref, checkout.Info.ShortCommit(), checkout.Dir)
+	if err := os.Chdir(filepath.Join(checkout.Dir, rel)); err != nil {
+		checkout.Remove()
+		return nil, nil, fmt.Errorf("%s does not exist at %s", rel, ref)
+	}
+	cleanup := func() {
+		os.Chdir(wd)
+		checkout.Remove()
+	}
+	if err := reloadConfig(wd); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return checkout.Info, cleanup, nil
+}
+
+// absolutePathFlags makes path flags absolute so that they stay relative to
+// the working directory the command was started in
+func absolutePathFlags(cmd *cobra.Command, wd string, names ...string) {
+	for _, name := range names {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || flag.Value.String() == "" || filepath.IsAbs(flag.Value.String()) {
+			continue
+		}
+		flag.Value.Set(filepath.Join(wd, flag.Value.String()))
+	}
+}
+
+// buildAndPush builds the image, or reuses the existing image of the commit,
+// and pushes it when requested
+func buildAndPush(ctx context.Context, cmd *cobra.Command, builder image.Builder, repo *config.Repo, registries []config.Registry, refs []string, info *git.Info, buildOpts *image.BuildOptions, push bool) (*image.Result, error) {
+	buildCtx, buildCancel := context.WithTimeout(ctx, getTimeout(cmd, "timeout", repo.Build.Timeout))
+	defer buildCancel()
+	sbomFormat, err := getSBOMFormat(cmd, &repo.Build, push)
+	if err != nil {
+		return nil, err
+	}
+	result, err := findExisting(buildCtx, cmd, builder, repo, registries, refs, info, buildOpts.Output)
+	if err != nil {
+		return nil, fmt.Errorf("Error looking up existing image: %s", err)
+	}
+	if result == nil {
+		if err := lintDockerfile(cmd, &repo.Lint, buildOpts.Dockerfile, buildOpts.Output); err != nil {
+			return nil, fmt.Errorf("lint error - %s", err)
+		}
+		result, err = builder.Build(buildCtx, buildOpts)
+		if err != nil {
+			return nil, fmt.Errorf("build error - %s", err)
+		}
+	}
+
+	pushCtx, pushCancel := context.WithTimeout(ctx, getTimeout(cmd, "push-timeout", repo.Build.PushTimeout))
+	defer pushCancel()
+	// an image that only exists in the registry has nothing to push
+	if push && result.ID != "" {
+		for i, ref := range refs {
+			digest, err := builder.Push(pushCtx, ref, buildOpts.Output)
+			if err != nil {
+				return nil, fmt.Errorf("push error - %s", err)
+			}
+			if i == 0 {
+				if err := result.SetDigest(ref, digest); err != nil {
+					return nil, fmt.Errorf("push error - %s", err)
+				}
+			}
+		}
+	}
+	if sbomFormat != "" {
+		if err := writeSBOM(pushCtx, cmd, builder, registries, sbomFormat, refs[0], info, buildOpts, result); err != nil {
+			return nil, fmt.Errorf("sbom error - %s", err)
+		}
+	}
+	return result, nil
+}
+
+// findExisting looks up the image of a clean commit locally and in the
+// registry when skipping existing images is enabled. A nil result means the
+// image has to be built.
+func findExisting(ctx context.Context, cmd *cobra.Command, builder image.Builder, repo *config.Repo, registries []config.Registry, refs []string, info *git.Info, out io.Writer) (*image.Result, error) {
+	skip := repo.Build.SkipExisting
+	if cmd.Flags().Changed("skip-existing") {
+		skip, _ = cmd.Flags().GetBool("skip-existing")
+	}
+	retag := repo.Build.RetagExisting
+	if cmd.Flags().Changed("retag-existing") {
+		retag, _ = cmd.Flags().GetBool("retag-existing")
+	}
+	if !skip && !retag {
+		return nil, nil
+	}
+	tag := image.CommitTag(&repo.Tags, info)
+	if tag == "" {
+		fmt.Fprintf(out, "Not looking for an existing image, the worktree is dirty or the tagging policy has no sha tag\n")
+		return nil, nil
+	}
+	ref, err := getImageReference(cmd, repo, tag)
+	if err != nil {
+		return nil, err
+	}
+	result := &image.Result{
+		Tags:     refs,
+		Revision: info.Commit,
+		Skipped:  true,
+	}
+
+	local, found, err := builder.Lookup(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		fmt.Fprintf(out, "Image %s exists locally, skipping build\n", ref)
+		for _, r := range refs {
+			if r == ref {
+				continue
+			}
+			if err := builder.Tag(ctx, ref, r); err != nil {
+				return nil, err
+			}
+		}
+		result.ID = local.ID
+		result.Size = local.Size
+		return result, nil
+	}
+
+	img, err := registry.ParseImage(ref)
+	if err != nil {
+		return nil, err
+	}
+	if !registryConfigured(cmd, repo, img) {
+		return nil, nil
+	}
+	// the lookup only saves a build, a registry that can not be reached is
+	// no reason to fail
+	result, err = findInRegistry(ctx, img, registries, ref, refs, retag, result, out)
+	if err != nil {
+		fmt.Fprintf(out, "Warning: could not look up %s in %s, building: %s\n", ref, img.Domain, err)
+		return nil, nil
+	}
+	return result, nil
+}
+
+// findInRegistry looks up the image of the commit in its registry and, with
+// retag, adds the other tags to it. A nil result means the image is missing.
+func findInRegistry(ctx context.Context, img *registry.Image, registries []config.Registry, ref string, refs []string, retag bool, result *image.Result, out io.Writer) (*image.Result, error) {
+	client, err := registry.NewClient(img.Domain, registries)
+	if err != nil {
+		return nil, err
+	}
+	digest, found, err := client.HeadManifest(ctx, img.Repository, img.Reference)
+	if err != nil || !found {
+		return nil, err
+	}
+	fmt.Fprintf(out, "Image %s exists in %s, skipping build\n", ref, img.Domain)
+	if err := result.SetDigest(ref, digest); err != nil {
+		return nil, err
+	}
+	if !retag {
+		result.Tags = []string{ref}
+		return result, nil
+	}
+	for _, r := range refs {
+		if r == ref {
+			continue
+		}
+		target, err := registry.ParseImage(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := client.Tag(ctx, img.Repository, digest, target.Reference); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(out, "Tagged %s\n", r)
+	}
+	return result, nil
+}
+
+// registryConfigured returns whether the image has a registry, set in the
+// repo config, with --registry or in the image name, images without one
+// would be looked up on Docker Hub
+func registryConfigured(cmd *cobra.Command, repo *config.Repo, img *registry.Image) bool {
+	r, _ := cmd.Flags().GetString("registry")
+	return r != "" || repo.Registry != "" || img.Domain != "docker.io"
+}
+
+// getBuildOptions merges the build flags on top of the repo build config
+func getBuildOptions(cmd *cobra.Command, build *config.Build) (*image.BuildOptions, error) {
+	opts := &image.BuildOptions{
+		Dockerfile:   build.Dockerfile,
+		Context:      build.Context,
+		Target:       build.Target,
+		BuildArgs:    map[string]*string{},
+		Labels:       map[string]string{},
+		NoCache:      build.NoCache,
+		Pull:         build.Pull,
+		Network:      build.Network,
+		NoOCILabels:  build.NoOCILabels,
+		Reproducible: build.Reproducible,
+	}
+	configArgs, err := build.BuildArgs()
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range configArgs {
+		value := value
+		opts.BuildArgs[key] = &value
+	}
+	configLabels, err := build.ImageLabels()
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range configLabels {
+		opts.Labels[key] = value
+	}
+
+	flags := cmd.Flags()
+	if flags.Changed("file") {
+		opts.Dockerfile, _ = flags.GetString("file")
+	}
+	if flags.Changed("context") {
+		opts.Context, _ = flags.GetString("context")
+	}
+	if flags.Changed("target") {
+		opts.Target, _ = flags.GetString("target")
+	}
+	if flags.Changed("network") {
+		opts.Network, _ = flags.GetString("network")
+	}
+	if flags.Changed("no-cache") {
+		opts.NoCache, _ = flags.GetBool("no-cache")
+	}
+	if flags.Changed("pull") {
+		opts.Pull, _ = flags.GetBool("pull")
+	}
+	if flags.Changed("no-oci-labels") {
+		opts.NoOCILabels, _ = flags.GetBool("no-oci-labels")
+	}
+	if flags.Changed("reproducible") {
+		opts.Reproducible, _ = flags.GetBool("reproducible")
+	}
+	buildArgs, _ := flags.GetStringArray("build-arg")
+	for _, arg := range buildArgs {
+		kv := strings.SplitN(arg, "=", 2)
+		if kv[0] == "" {
+			return nil, fmt.Errorf("Invalid build-arg: %s", arg)
+		}
+		if len(kv) == 2 {
+			opts.BuildArgs[kv[0]] = &kv[1]
+			continue
+		}
+		// KEY without a value is taken from the environment, like docker does
+		if value, ok := os.LookupEnv(kv[0]); ok {
+			opts.BuildArgs[kv[0]] = &value
+		} else {
+			delete(opts.BuildArgs, kv[0])
+		}
+	}
+	labels, _ := flags.GetStringArray("label")
+	for _, label := range labels {
+		kv := strings.SplitN(label, "=", 2)
+		if kv[0] == "" {
+			return nil, fmt.Errorf("Invalid label: %s", label)
+		}
+		if len(kv) == 2 {
+			opts.Labels[kv[0]] = kv[1]
+		} else {
+			opts.Labels[kv[0]] = ""
+		}
+	}
+
+	if opts.Context == "" {
+		opts.Context = "."
+	}
+	if opts.Dockerfile == "" {
+		opts.Dockerfile = filepath.Join(opts.Context, "Dockerfile")
+	}
+	return opts, nil
 }
@@ -0,0 +1,306 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/cldmnky/dev-tool/pkg/git"
+	"github.com/cldmnky/dev-tool/pkg/image"
+	"github.com/cldmnky/dev-tool/pkg/registry"
+	"github.com/spf13/cobra"
+)
+
+const defaultParallel = 2
+
+// serviceResult is the outcome of building one service
+type serviceResult struct {
+	Service string `json:"service"`
+	Error   string `json:"error,omitempty"`
+	*image.Result
+}
+
+// buildAll builds the services of a monorepo in dependency order. A service
+// building FROM another service with a build arg as the tag, like
+// base:${BASE_TAG}, gets the arg set to the tag just built, with a fixed tag
+// the dependency only orders the builds.
+func buildAll(ctx context.Context, cmd *cobra.Command, cfg *config.Config, info *git.Info, output string) error {
+	for _, flag := range []string{"image", "file", "context", "target"} {
+		if cmd.Flags().Changed(flag) {
+			return fmt.Errorf("--%s can not be used with --all", flag)
+		}
+	}
+	services, err := getServices(&cfg.Repo)
+	if err != nil {
+		return fmt.Errorf("Error finding services: %s", err)
+	}
+
+	var outputLock sync.Mutex
+	jobs := []*image.Job{}
+	repos := map[string]*config.Repo{}
+	builders := map[string]image.Builder{}
+	refs := map[string][]string{}
+	opts := map[string]*image.BuildOptions{}
+	for _, svc := range services {
+		repo := serviceRepo(&cfg.Repo, svc)
+		svcRefs, err := imageReferences(cmd, repo, info)
+		if err != nil {
+			return fmt.Errorf("Error getting image name for %s: %s", svc.Name, err)
+		}
+		buildOpts, err := getBuildOptions(cmd, &repo.Build)
+		if err != nil {
+			return fmt.Errorf("Error parsing build options for %s: %s", svc.Name, err)
+		}
+		buildOpts.Tags = svcRefs
+		buildOpts.Git = info
+		buildOpts.Output = &prefixWriter{
+			prefix: fmt.Sprintf("[%s] ", svc.Name),
+			out:    os.Stderr,
+			mu:     &outputLock,
+		}
+		builder, err := getBuilder(cmd, cfg, &repo.Build)
+		if err != nil {
+			return fmt.Errorf("Error getting builder for %s: %s", svc.Name, err)
+		}
+		builders[svc.Name] = builder
+		repos[svc.Name] = repo
+		refs[svc.Name] = svcRefs
+		opts[svc.Name] = buildOpts
+		jobs = append(jobs, &image.Job{
+			Name:       svc.Name,
+			Image:      svcRefs[0],
+			Dockerfile: buildOpts.Dockerfile,
+		})
+	}
+	if err := image.ResolveDependencies(jobs); err != nil {
+		return fmt.Errorf("Error resolving dependencies: %s", err)
+	}
+	if changed, _ := cmd.Flags().GetBool("changed"); changed {
+		changes, err := getChanges(cmd, "")
+		if err != nil {
+			return err
+		}
+		affected, err := changedServices(services, repos, changes)
+		if err != nil {
+			return fmt.Errorf("Error mapping changes to services: %s", err)
+		}
+		jobs = selectJobs(jobs, affected)
+		if len(jobs) == 0 {
+			fmt.Fprintf(os.Stderr, "No services affected by the changes\n")
+			return printSummary([]serviceResult{}, output)
+		}
+	}
+
+	parallel := cfg.Repo.Parallel
+	if cmd.Flags().Changed("parallel") || parallel < 1 {
+		parallel, _ = cmd.Flags().GetInt("parallel")
+	}
+	fmt.Fprintf(os.Stderr, "Tagging policy: %s\n", image.DescribePolicy(&cfg.Repo.Tags))
+	fmt.Fprintf(os.Stderr, "Building %d images, %d at a time\n", len(jobs), parallel)
+	for _, job := range jobs {
+		deps := ""
+		if len(job.DependsOn) > 0 {
+			deps = fmt.Sprintf(" (after %s)", strings.Join(job.DependsOn, ", "))
+		}
+		if fixed := fixedBases(job); len(fixed) > 0 {
+			deps += fmt.Sprintf(" (%s as tagged in the Dockerfile)", strings.Join(fixed, ", "))
+		}
+		fmt.Fprintf(os.Stderr, "  %s: %s%s\n", job.Name, job.Image, deps)
+	}
+
+	push, _ := cmd.Flags().GetBool("push")
+	var resultLock sync.Mutex
+	results := map[string]*image.Result{}
+	errs := image.RunGraph(ctx, jobs, parallel, func(ctx context.Context, job *image.Job) error {
+		for arg, dep := range job.BaseArgs {
+			resultLock.Lock()
+			built := results[dep]
+			resultLock.Unlock()
+			img, err := registry.ParseImage(built.Tags[0])
+			if err != nil {
+				return err
+			}
+			tag := img.Reference
+			opts[job.Name].BuildArgs[arg] = &tag
+			fmt.Fprintf(opts[job.Name].Output, "Building on %s, %s=%s\n", built.Tags[0], arg, tag)
+		}
+		result, err := buildAndPush(ctx, cmd, builders[job.Name], repos[job.Name], cfg.Registries, refs[job.Name], info, opts[job.Name], push)
+		if err != nil {
+			return err
+		}
+		resultLock.Lock()
+		results[job.Name] = result
+		resultLock.Unlock()
+		return nil
+	})
+
+	summary := []serviceResult{}
+	failed := 0
+	for _, job := range jobs {
+		r := serviceResult{
+			Service: job.Name,
+			Result:  results[job.Name],
+		}
+		if err := errs[job.Name]; err != nil {
+			r.Error = err.Error()
+			failed++
+		}
+		summary = append(summary, r)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		return summary[i].Service < summary[j].Service
+	})
+	if err := printSummary(summary, output); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images failed to build", failed, len(jobs))
+	}
+	return nil
+}
+
+// fixedBases returns the dependencies of a job it builds FROM with a fixed
+// tag
+func fixedBases(job *image.Job) []string {
+	fixed := []string{}
+	for _, dep := range job.DependsOn {
+		found := false
+		for _, d := range job.BaseArgs {
+			found = found || d == dep
+		}
+		if !found {
+			fixed = append(fixed, dep)
+		}
+	}
+	return fixed
+}
+
+// printSummary prints the outcome of every service build
+func printSummary(summary []serviceResult, output string) error {
+	if output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summary)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tSTATUS\tDURATION\tIMAGE")
+	for _, r := range summary {
+		switch {
+		case r.Error != "":
+			fmt.Fprintf(w, "%s\tfailed: %s\t\t\n", r.Service, r.Error)
+		case r.Skipped:
+			fmt.Fprintf(w, "%s\tskipped\t\t%s\n", r.Service, firstNonEmpty(r.Digest, r.Tags[0]))
+		default:
+			fmt.Fprintf(w, "%s\tbuilt\t%.1fs\t%s\n", r.Service, r.Duration, firstNonEmpty(r.Digest, r.Tags[0]))
+		}
+	}
+	return w.Flush()
+}
+
+// getServices returns the services declared in the repo config, or one
+// service per Dockerfile found below the working directory
+func getServices(repo *config.Repo) ([]config.Service, error) {
+	if len(repo.Services) > 0 {
+		names := map[string]bool{}
+		for _, svc := range repo.Services {
+			if svc.Name == "" {
+				return nil, fmt.Errorf("Service without a name in repo config")
+			}
+			if names[svc.Name] {
+				return nil, fmt.Errorf("Duplicate service %s in repo config", svc.Name)
+			}
+			names[svc.Name] = true
+		}
+		return repo.Services, nil
+	}
+
+	services := []config.Service{}
+	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if path != "." && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() != "Dockerfile" {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		svc := config.Service{
+			Name: filepath.Base(dir),
+			Path: dir,
+		}
+		if dir == "." {
+			// the root Dockerfile builds the repo image
+			svc.Name = repo.Image
+			if svc.Name == "" {
+				wd, err := os.Getwd()
+				if err != nil {
+					return err
+				}
+				svc.Name = strings.ToLower(filepath.Base(wd))
+			}
+		}
+		services = append(services, svc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("No services in repo config and no Dockerfiles found")
+	}
+	return services, nil
+}
+
+// serviceRepo returns the repo config for building a service
+func serviceRepo(repo *config.Repo, svc config.Service) *config.Repo {
+	svcRepo := *repo
+	svcRepo.Image = svc.Image
+	if svcRepo.Image == "" {
+		svcRepo.Image = svc.Name
+	}
+	svcRepo.Build = repo.Build.Merge(svc.Build)
+	if svc.Build.Context == "" && svc.Path != "" {
+		svcRepo.Build.Context = svc.Path
+	}
+	if svc.Build.Dockerfile == "" {
+		svcRepo.Build.Dockerfile = filepath.Join(svcRepo.Build.Context, "Dockerfile")
+	}
+	return &svcRepo
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/cldmnky/dev-tool/pkg/git"
+	"github.com/cldmnky/dev-tool/pkg/image"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestFindExistingFallsBackToBuilding(t *testing.T) {
+	output, err := ioutil.TempDir("", "dev-tool-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(output)
+	builder, err := image.NewBuilder(image.OCIBuilder, output, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	info := &git.Info{Commit: strings.Repeat("a", 40)}
+
+	tests := []struct {
+		name     string
+		registry string
+		lookup   bool
+	}{
+		{name: "registry fails", registry: strings.TrimPrefix(broken.URL, "http://"), lookup: true},
+		// without a registry the image would be looked up on Docker Hub
+		{name: "no registry", registry: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+			cmd := &cobra.Command{}
+			addImageNameFlags(cmd.Flags())
+			addBuildFlags(cmd.Flags())
+			repo := &config.Repo{
+				Registry: tt.registry,
+				Image:    "app",
+				Tags:     config.Tags{ShortSha: true},
+				Build:    config.Build{SkipExisting: true},
+			}
+			var out bytes.Buffer
+			result, err := findExisting(context.Background(), cmd, builder, repo, nil, nil, info, &out)
+			if err != nil || result != nil {
+				t.Fatalf("findExisting = %v %v, want to build", result, err)
+			}
+			if looked := atomic.LoadInt32(&requests) > 0; looked != tt.lookup {
+				t.Errorf("registry looked up %v, want %v", looked, tt.lookup)
+			}
+			if warned := strings.Contains(out.String(), "Warning"); warned != tt.lookup {
+				t.Errorf("output %q, want a warning %v", out.String(), tt.lookup)
+			}
+		})
+	}
+}
+
+func TestReloadConfigUsesTheCheckout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dev-tool-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	files := map[string]string{
+		"home/dev-tool.yaml":     "registries:\n- host: registry.example.com\n",
+		"worktree/dev-tool.yaml": "repo:\n  image: app\n  repository: team\n  build:\n    args:\n    - NEW=1\n",
+		"checkout/dev-tool.yaml": "repo:\n  image: app\n  build:\n    args:\n    - OLD=1\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	worktree := filepath.Join(dir, "worktree")
+
+	tests := []struct {
+		name       string
+		userConfig string
+		registries int
+	}{
+		{name: "user config", userConfig: filepath.Join(dir, "home", "dev-tool.yaml"), registries: 1},
+		{name: "only the repo config", userConfig: filepath.Join(worktree, "dev-tool.yaml")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			if err := os.Chdir(worktree); err != nil {
+				t.Fatal(err)
+			}
+			viper.SetConfigFile(tt.userConfig)
+			if err := viper.ReadInConfig(); err != nil {
+				t.Fatal(err)
+			}
+			if err := mergeRepoConfig(); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chdir(filepath.Join(dir, "checkout")); err != nil {
+				t.Fatal(err)
+			}
+			if err := reloadConfig(worktree); err != nil {
+				t.Fatal(err)
+			}
+			cfg := getConfig()
+			if cfg.Repo.Repository != "" || strings.Join(cfg.Repo.Build.Args, ",") != "OLD=1" {
+				t.Errorf("repo config = %+v, want the one of the checkout", cfg.Repo)
+			}
+			if len(cfg.Registries) != tt.registries {
+				t.Errorf("%d registries, want %d from the user config", len(cfg.Registries), tt.registries)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/cldmnky/dev-tool/pkg/git"
+	"github.com/cldmnky/dev-tool/pkg/image"
+	"github.com/spf13/cobra"
+)
+
+// getChanges returns the paths changed since the --base revision, else since
+// defaultBase or, when that is empty, the merge-base with the default branch
+func getChanges(cmd *cobra.Command, defaultBase string) (*git.Changes, error) {
+	base, _ := cmd.Flags().GetString("base")
+	if base == "" {
+		base = defaultBase
+	}
+	changes, err := git.ChangedPaths(".", base)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting changed paths: %s", err)
+	}
+	fmt.Fprintf(os.Stderr, "%d paths changed since %s\n", len(changes.Paths), changes.Base[0:8])
+	return changes, nil
+}
+
+// changedServices returns the services affected by the changes, a service is
+// affected when a path in its directory, build context or one of its watched
+// paths changed
+func changedServices(services []config.Service, repos map[string]*config.Repo, changes *git.Changes) (map[string]bool, error) {
+	affected := map[string]bool{}
+	for _, svc := range services {
+		paths := append([]string{svc.Path}, svc.Watch...)
+		if repo, ok := repos[svc.Name]; ok {
+			context := repo.Build.Context
+			if context == "" {
+				context = "."
+			}
+			paths = append(paths, context, repo.Build.Dockerfile)
+		}
+		for _, path := range paths {
+			if path == "" {
+				continue
+			}
+			rel, err := repoPath(changes.Root, path)
+			if err != nil {
+				return nil, err
+			}
+			if pathChanged(rel, changes.Paths) {
+				affected[svc.Name] = true
+				break
+			}
+		}
+	}
+	return affected, nil
+}
+
+// selectJobs keeps the selected jobs and every job building FROM them,
+// dependencies on jobs that are left out are dropped
+func selectJobs(jobs []*image.Job, selected map[string]bool) []*image.Job {
+	for changed := true; changed; {
+		changed = false
+		for _, job := range jobs {
+			if selected[job.Name] {
+				continue
+			}
+			for _, dep := range job.DependsOn {
+				if selected[dep] {
+					selected[job.Name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	kept := []*image.Job{}
+	for _, job := range jobs {
+		if !selected[job.Name] {
+			continue
+		}
+		deps := []string{}
+		for _, dep := range job.DependsOn {
+			if selected[dep] {
+				deps = append(deps, dep)
+			}
+		}
+		job.DependsOn = deps
+		for arg, dep := range job.BaseArgs {
+			if !selected[dep] {
+				delete(job.BaseArgs, arg)
+			}
+		}
+		kept = append(kept, job)
+	}
+	return kept
+}
+
+// repoPath returns path, relative to the working directory, relative to the
+// worktree root in git notation
+func repoPath(root string, path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// pathChanged returns whether path or anything below it is in changed
+func pathChanged(path string, changed []string) bool {
+	for _, c := range changed {
+		if path == "." || c == path || strings.HasPrefix(c, path+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,404 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/cldmnky/dev-tool/pkg/git"
+	"github.com/cldmnky/dev-tool/pkg/helm"
+	"github.com/docker/distribution/reference"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+const defaultChart = "chart"
+
+// deployCmd represents the deploy command
+var deployCmd = &cobra.Command{
+	Use:   "deploy",
+	Short: "Build, push and deploy the image with helm",
+	Long: `Build and push the image of the current commit, then upgrade or install
+the helm chart of the repo in the Rancher project and namespace of an
+environment. The project and namespace are created when missing and the chart
+is deployed with image.repository and image.tag set to the pushed image.
+
+Chart values are merged in this order, later ones take precedence:
+
+  values.yaml of the chart
+  values-<environment>.yaml of the chart
+  values of the environment in repo config
+  image.repository and image.tag of the built image
+  files given with --values
+  --set`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := getConfig()
+		d, err := getDeployment(cmd, cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if show, _ := cmd.Flags().GetBool("show-values"); show {
+			if err := helm.PrintValues(os.Stdout, d.values, d.origins); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		if diff, _ := cmd.Flags().GetBool("diff"); diff {
+			changed, err := diffDeployment(cmd, d)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if changed {
+				os.Exit(diffExitCode)
+			}
+			return
+		}
+
+		kubeConfig, err := setupRancher(os.Stderr, d.env.Name, d.env.Cluster, d.env.Project, d.env.Namespace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		runner, err := helm.NewRunner(kubeConfig, d.env.Namespace, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if changed, _ := cmd.Flags().GetBool("changed"); changed {
+			affected, err := deploymentChanged(cmd, &cfg.Repo, d, runner)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if !affected {
+				fmt.Fprintf(os.Stderr, "Nothing changed for %s, skipping the deploy\n", d.release)
+				return
+			}
+		}
+
+		buildOpts, err := getBuildOptions(cmd, &cfg.Repo.Build)
+		if err != nil {
+			log.Fatalf("Error parsing build options: %s", err)
+		}
+		buildOpts.Tags = d.refs
+		buildOpts.Git = d.info
+		buildOpts.Output = os.Stderr
+		builder, err := getBuilder(cmd, cfg, &cfg.Repo.Build)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ctx, cancel := signalContext()
+		defer cancel()
+		result, err := buildAndPush(ctx, cmd, builder, &cfg.Repo, cfg.Registries, d.refs, d.info, buildOpts, true)
+		if err != nil {
+			log.Fatal(err)
+		}
+		wait, _ := cmd.Flags().GetBool("wait")
+		atomic, _ := cmd.Flags().GetBool("atomic")
+		fmt.Fprintf(os.Stderr, "Deploying %s to %s/%s in %s\n", d.refs[0], d.env.Cluster, d.env.Namespace, d.env.Name)
+		rel, err := runner.Upgrade(d.release, d.chart, d.values, &helm.Options{
+			Install: true,
+			Wait:    wait,
+			Atomic:  atomic,
+			Timeout: getTimeout(cmd, "deploy-timeout", cfg.Repo.Deploy.Timeout),
+		})
+		if err != nil {
+			log.Fatalf("deploy error - %s", err)
+		}
+		fmt.Printf("Image: %s\n", d.refs[0])
+		if result.Digest != "" {
+			fmt.Printf("Digest: %s\n", result.Digest)
+		}
+		fmt.Printf("Release: %s\n", rel.Name)
+		fmt.Printf("Revision: %d\n", rel.Version)
+		fmt.Printf("Namespace: %s\n", rel.Namespace)
+		fmt.Printf("Status: %s\n", rel.Info.Status)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deployCmd)
+	addDeployFlags(deployCmd)
+	deployCmd.Flags().Bool("wait", true, "Wait until the resources of the release are ready")
+	deployCmd.Flags().Bool("atomic", false, "Roll back the release when the deploy fails")
+	deployCmd.Flags().Duration("deploy-timeout", defaultTimeout, "Timeout for the helm upgrade")
+	deployCmd.Flags().Bool("show-values", false, "Print the merged chart values with the origin of each key instead of deploying")
+	deployCmd.Flags().Bool("diff", false, "Print the changes to the deployed release instead of deploying, exits with 2 when there are changes")
+	deployCmd.Flags().Bool("no-color", false, "Do not color the diff")
+	deployCmd.Flags().Bool("changed", false, "Only deploy when the image or chart changed since --base")
+	deployCmd.Flags().String("base", "", "Revision to detect changes from (default is the commit of the deployed release)")
+	addImageFlags(deployCmd.Flags())
+	addBuildFlags(deployCmd.Flags())
+}
+
+// addDeployFlags adds the flags that select the environment, chart, values
+// and release of a deploy
+func addDeployFlags(cmd *cobra.Command) {
+	addReleaseFlags(cmd)
+	cmd.Flags().String("chart", "", "Path to the helm chart (default from repo config or chart)")
+	cmd.Flags().StringArray("values", []string{}, "Chart values file, can be repeated")
+	cmd.Flags().StringArray("set", []string{}, "Set a chart value, KEY=VAL with nested keys like a.b=c")
+}
+
+// addReleaseFlags adds the flags that select the environment and release,
+// shared by the commands that deploy or manage a release
+func addReleaseFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("environment", "e", "", "Environment of the release, i.e. test or prod")
+	cmd.Flags().StringP("cluster", "c", "", "Kubernetes cluster (default from the environment in repo config)")
+	cmd.Flags().StringP("project", "p", "", "Rancher project (default from the environment in repo config)")
+	cmd.Flags().StringP("namespace", "n", "", "Kubernetes namespace (default from the environment in repo config)")
+	cmd.Flags().String("release", "", "Helm release name (default from repo config or the image name)")
+	cmd.MarkFlagRequired("environment")
+}
+
+// deployment is a release of the chart resolved from the repo config and
+// flags, shared by deploy and diff
+type deployment struct {
+	env       *config.Environment
+	chart     *chart.Chart
+	chartPath string
+	release   string
+	// refs are the image references of the current commit
+	refs    []string
+	info    *git.Info
+	values  map[string]interface{}
+	origins map[string]string
+}
+
+// getDeployment resolves the environment, chart, release name and merged
+// values of a deployment of the current commit
+func getDeployment(cmd *cobra.Command, cfg *config.Config) (*deployment, error) {
+	name, _ := cmd.Flags().GetString("environment")
+	env, err := getEnvironment(cmd, &cfg.Repo.Deploy, name)
+	if err != nil {
+		return nil, err
+	}
+	chartPath := getChartPath(cmd, &cfg.Repo.Deploy)
+	ch, err := helm.LoadChart(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	refs, info, err := getImageReferences(cmd, &cfg.Repo)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting image name: %s", err)
+	}
+	helm.Annotate(ch, map[string]string{
+		helm.AnnotationImage:  refs[0],
+		helm.AnnotationCommit: info.Commit,
+	})
+	imageVals, err := imageValues(refs[0])
+	if err != nil {
+		return nil, err
+	}
+	sources, err := getValueSources(cmd, ch, chartPath, env, imageVals)
+	if err != nil {
+		return nil, err
+	}
+	values, origins := helm.MergeValues(sources)
+	return &deployment{
+		env:       env,
+		chart:     ch,
+		chartPath: chartPath,
+		release:   getReleaseName(cmd, &cfg.Repo.Deploy, refs[0]),
+		refs:      refs,
+		info:      info,
+		values:    values,
+		origins:   origins,
+	}, nil
+}
+
+// deploymentChanged returns whether the build context, Dockerfile, chart,
+// values files or repo config changed since the --base revision, by default
+// the commit of the deployed release. A release that is not deployed, or
+// has no commit annotation, has changed.
+func deploymentChanged(cmd *cobra.Command, repo *config.Repo, d *deployment, runner *helm.Runner) (bool, error) {
+	base := ""
+	if b, _ := cmd.Flags().GetString("base"); b == "" {
+		deployed, err := runner.Deployed(d.release)
+		if err != nil {
+			return false, fmt.Errorf("Could not get release %s: %s", d.release, err)
+		}
+		if deployed == nil {
+			fmt.Fprintf(os.Stderr, "Release %s is not deployed\n", d.release)
+			return true, nil
+		}
+		base = helm.Summarize(deployed).Commit
+		if base == "" {
+			fmt.Fprintf(os.Stderr, "Revision %d of %s has no commit, use --base\n", deployed.Version, d.release)
+			return true, nil
+		}
+	}
+	changes, err := getChanges(cmd, base)
+	if err != nil {
+		return false, err
+	}
+	context := repo.Build.Context
+	if context == "" {
+		context = "."
+	}
+	paths := []string{context, repo.Build.Dockerfile, d.chartPath, configFileName}
+	files, _ := cmd.Flags().GetStringArray("values")
+	for _, path := range append(paths, files...) {
+		if path == "" {
+			continue
+		}
+		rel, err := repoPath(changes.Root, path)
+		if err != nil {
+			return false, err
+		}
+		if pathChanged(rel, changes.Paths) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getRelease returns the environment and the helm release name of the repo,
+// for the commands that manage a deployed release
+func getRelease(cmd *cobra.Command, cfg *config.Config) (*config.Environment, string, error) {
+	name, _ := cmd.Flags().GetString("environment")
+	env, err := getEnvironment(cmd, &cfg.Repo.Deploy, name)
+	if err != nil {
+		return nil, "", err
+	}
+	// only the name of the image is used
+	ref, err := getImageReference(cmd, &cfg.Repo, "latest")
+	if err != nil {
+		return nil, "", err
+	}
+	return env, getReleaseName(cmd, &cfg.Repo.Deploy, ref), nil
+}
+
+// releaseRunner returns a helm runner for the namespace of an environment,
+// unlike deploy the project and namespace are not created
+func releaseRunner(env *config.Environment) (*helm.Runner, error) {
+	kubeConfig, err := rancherKubeConfig(os.Stderr, env.Name, env.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	return helm.NewRunner(kubeConfig, env.Namespace, nil)
+}
+
+// getEnvironment returns the Rancher location of an environment from the
+// repo config, flags override it
+func getEnvironment(cmd *cobra.Command, deploy *config.Deploy, name string) (*config.Environment, error) {
+	env := config.Environment{Name: name}
+	for _, e := range deploy.Environments {
+		if e.Name == name {
+			env = e
+			break
+		}
+	}
+	for flag, value := range map[string]*string{
+		"cluster":   &env.Cluster,
+		"project":   &env.Project,
+		"namespace": &env.Namespace,
+	} {
+		if v, _ := cmd.Flags().GetString(flag); v != "" {
+			*value = v
+		}
+	}
+	if env.Cluster == "" || env.Project == "" || env.Namespace == "" {
+		return nil, fmt.Errorf("Environment %s needs a cluster, project and namespace, set them in repo config or with flags", name)
+	}
+	return &env, nil
+}
+
+// getChartPath returns the path of the helm chart, the --chart flag
+// overrides the repo config
+func getChartPath(cmd *cobra.Command, deploy *config.Deploy) string {
+	if chart, _ := cmd.Flags().GetString("chart"); chart != "" {
+		return chart
+	}
+	if deploy.Chart != "" {
+		return deploy.Chart
+	}
+	return defaultChart
+}
+
+// getReleaseName returns the helm release name, by default the last path
+// component of the image
+func getReleaseName(cmd *cobra.Command, deploy *config.Deploy, ref string) string {
+	if release, _ := cmd.Flags().GetString("release"); release != "" {
+		return release
+	}
+	if deploy.Release != "" {
+		return deploy.Release
+	}
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return path.Base(ref)
+	}
+	return path.Base(reference.Path(named))
+}
+
+// imageValues returns the chart values that point image.repository and
+// image.tag at an image reference
+func imageValues(ref string) (map[string]interface{}, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse image reference %s: %s", ref, err)
+	}
+	tagged, ok := named.(reference.Tagged)
+	if !ok {
+		return nil, fmt.Errorf("Image reference %s has no tag", ref)
+	}
+	return map[string]interface{}{
+		"image": map[string]interface{}{
+			"repository": named.Name(),
+			"tag":        tagged.Tag(),
+		},
+	}, nil
+}
+
+// getValueSources returns the chart values in order of precedence, lowest
+// first
+func getValueSources(cmd *cobra.Command, ch *chart.Chart, chartPath string, env *config.Environment, image map[string]interface{}) ([]helm.ValueSource, error) {
+	sources := []helm.ValueSource{
+		{Origin: filepath.Join(chartPath, "values.yaml"), Values: ch.Values},
+	}
+	envFile := fmt.Sprintf("values-%s.yaml", env.Name)
+	for _, f := range ch.Files {
+		if f.Name != envFile {
+			continue
+		}
+		values, err := helm.ReadValues(f.Data)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read values %s: %s", filepath.Join(chartPath, envFile), err)
+		}
+		sources = append(sources, helm.ValueSource{Origin: filepath.Join(chartPath, envFile), Values: values})
+	}
+	sources = append(sources,
+		helm.ValueSource{Origin: fmt.Sprintf("config environment %s", env.Name), Values: env.Values},
+		helm.ValueSource{Origin: "image", Values: image},
+	)
+	files, _ := cmd.Flags().GetStringArray("values")
+	for _, file := range files {
+		values, err := helm.ReadValuesFile(file)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, helm.ValueSource{Origin: file, Values: values})
+	}
+	pairs, _ := cmd.Flags().GetStringArray("set")
+	set, err := helm.ParseSet(pairs)
+	if err != nil {
+		return nil, err
+	}
+	return append(sources, helm.ValueSource{Origin: "--set", Values: set}), nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/cldmnky/dev-tool/pkg/helm"
+	"github.com/docker/docker/pkg/term"
+	"github.com/spf13/cobra"
+)
+
+// diffExitCode is the exit status of a diff with changes, errors exit with 1
+const diffExitCode = 2
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show the changes a deploy would make",
+	Long: `Render the helm chart with the values of a deploy of the current commit and
+print a diff, per Kubernetes object, against the deployed release. Labels
+generated from the chart version are ignored. Nothing is built or changed, the
+exit status is 2 when there are changes so CI can gate on it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := getConfig()
+		d, err := getDeployment(cmd, cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		changed, err := diffDeployment(cmd, d)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if changed {
+			os.Exit(diffExitCode)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	addDeployFlags(diffCmd)
+	diffCmd.Flags().Bool("no-color", false, "Do not color the diff")
+	addImageFlags(diffCmd.Flags())
+}
+
+// diffDeployment prints the changes of a deployment to the deployed release,
+// all objects when the release is not installed, and returns whether there
+// are any
+func diffDeployment(cmd *cobra.Command, d *deployment) (bool, error) {
+	runner, err := releaseRunner(d.env)
+	if err != nil {
+		return false, err
+	}
+	current := ""
+	deployed, err := runner.Deployed(d.release)
+	if err != nil {
+		return false, fmt.Errorf("Could not get release %s: %s", d.release, err)
+	}
+	if deployed != nil {
+		current = deployed.Manifest
+		fmt.Fprintf(os.Stderr, "Comparing %s with revision %d of %s\n", d.refs[0], deployed.Version, d.release)
+	} else {
+		fmt.Fprintf(os.Stderr, "Release %s is not deployed in %s/%s\n", d.release, d.env.Cluster, d.env.Namespace)
+	}
+	next, err := runner.Render(d.release, d.chart, d.values)
+	if err != nil {
+		return false, fmt.Errorf("Could not render chart: %s", err)
+	}
+	diffs, err := helm.DiffManifests(current, next)
+	if err != nil {
+		return false, err
+	}
+	noColor, _ := cmd.Flags().GetBool("no-color")
+	helm.PrintDiffs(os.Stdout, diffs, !noColor && term.IsTerminal(os.Stdout.Fd()))
+	fmt.Fprintf(os.Stderr, "%d objects changed\n", len(diffs))
+	return len(diffs) > 0, nil
+}
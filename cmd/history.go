@@ -0,0 +1,56 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"log"
+	"os"
+
+	"github.com/cldmnky/dev-tool/pkg/helm"
+	"github.com/spf13/cobra"
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the revisions of the release",
+	Long: `Show every revision of the helm release of the repo in an environment with
+its status, image tag and the git commit it was deployed from.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := getConfig()
+		env, release, err := getRelease(cmd, cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		runner, err := releaseRunner(env)
+		if err != nil {
+			log.Fatal(err)
+		}
+		history, err := runner.History(release)
+		if err != nil {
+			log.Fatalf("Could not get history of %s: %s", release, err)
+		}
+		if err := helm.PrintHistory(os.Stdout, history); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	addReleaseFlags(historyCmd)
+	addImageNameFlags(historyCmd.Flags())
+}
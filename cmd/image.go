@@ -17,8 +17,15 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/cldmnky/dev-tool/pkg/git"
+	"github.com/cldmnky/dev-tool/pkg/image"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // imageCmd represents the image command
@@ -43,4 +50,102 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// imageCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	addImageFlags(imageCmd.PersistentFlags())
+}
+
+// addImageFlags adds the flags that name the image and select the builder,
+// shared by the image commands and deploy
+func addImageFlags(flags *pflag.FlagSet) {
+	addImageNameFlags(flags)
+	flags.String("builder", image.DockerBuilder, "Builder backend, docker or oci to build simple Dockerfiles without a daemon")
+	flags.String("engine", "", "Container engine environment from the config (default is DEV_TOOL_ENGINE or the docker environment)")
+	flags.String("oci-output", "", "OCI layout directory or .tar file of the oci builder (default is a layout in the user cache directory)")
+}
+
+// addImageNameFlags adds the flags that name the image, shared with the
+// commands that find a release by its image
+func addImageNameFlags(flags *pflag.FlagSet) {
+	flags.StringP("image", "i", "", "Image name (default from repo config or the current directory)")
+	flags.StringP("registry", "r", "", "Registry host (default from repo config)")
+}
+
+// getImageReference returns the normalized image reference, flags override
+// the repo config
+func getImageReference(cmd *cobra.Command, repo *config.Repo, tag string) (string, error) {
+	registry := repo.Registry
+	if r, _ := cmd.Flags().GetString("registry"); r != "" {
+		registry = r
+	}
+	name := repo.Image
+	if i, _ := cmd.Flags().GetString("image"); i != "" {
+		name = i
+	}
+	if name == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		name = strings.ToLower(filepath.Base(wd))
+	}
+	return image.Reference(registry, repo.Repository, name, tag)
+}
+
+// getImageReferences returns the image references for the current commit
+// according to the tagging policy in the repo config
+func getImageReferences(cmd *cobra.Command, repo *config.Repo) ([]string, *git.Info, error) {
+	info, err := git.GetInfo(".")
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error getting git info: %s", err)
+	}
+	refs, err := imageReferences(cmd, repo, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	return refs, info, nil
+}
+
+// imageReferences returns the image references for the git metadata
+func imageReferences(cmd *cobra.Command, repo *config.Repo, info *git.Info) ([]string, error) {
+	refs := []string{}
+	for _, tag := range image.Tags(&repo.Tags, info) {
+		ref, err := getImageReference(cmd, repo, tag)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// getBuilder returns the builder backend, the --builder flag overrides the
+// build config
+func getBuilder(cmd *cobra.Command, cfg *config.Config, build *config.Build) (image.Builder, error) {
+	name := build.Builder
+	if cmd.Flags().Changed("builder") {
+		name, _ = cmd.Flags().GetString("builder")
+	}
+	output, _ := cmd.Flags().GetString("oci-output")
+	engine, err := getEngine(cmd, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return image.NewBuilder(name, output, engine, cfg.Registries)
+}
+
+// getEngine returns the container engine selected with --engine or
+// DEV_TOOL_ENGINE, nil when none is selected
+func getEngine(cmd *cobra.Command, cfg *config.Config) (*config.Engine, error) {
+	name, _ := cmd.Flags().GetString("engine")
+	if name == "" {
+		name = os.Getenv("DEV_TOOL_ENGINE")
+	}
+	if name == "" {
+		return nil, nil
+	}
+	for i := range cfg.Engines {
+		if cfg.Engines[i].Environment == name {
+			return &cfg.Engines[i], nil
+		}
+	}
+	return nil, fmt.Errorf("Could not find an engine for environment %s in config", name)
 }
@@ -0,0 +1,99 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/cldmnky/dev-tool/pkg/lint"
+	"github.com/spf13/cobra"
+)
+
+// lintCmd represents the lint command
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Lint a Dockerfile",
+	Long: `Check a Dockerfile for images running as root, unpinned base images,
+ADD of remote URLs and other common mistakes. Rules are disabled or their
+severity changed in the lint section of the repo config.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfig()
+		output, _ := cmd.Flags().GetString("output")
+		if cmd.Flags().Changed("fail-on") {
+			config.Repo.Lint.FailOn, _ = cmd.Flags().GetString("fail-on")
+		}
+		dockerFile := config.Repo.Build.Dockerfile
+		if cmd.Flags().Changed("file") {
+			dockerFile, _ = cmd.Flags().GetString("file")
+		}
+		if dockerFile == "" {
+			dockerFile = filepath.Join(config.Repo.Build.Context, "Dockerfile")
+		}
+		findings, err := lint.Lint(dockerFile, &config.Repo.Lint)
+		if err != nil {
+			log.Fatalf("Error linting %s: %s", dockerFile, err)
+		}
+		if err := lint.Print(os.Stdout, findings, output); err != nil {
+			log.Fatal(err)
+		}
+		failOn, fail, err := lint.FailOn(&config.Repo.Lint)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if fail && lint.Failed(findings, failOn) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	imageCmd.AddCommand(lintCmd)
+	lintCmd.Flags().StringP("file", "f", "", "Path to the Dockerfile (default from repo config or Dockerfile)")
+	lintCmd.Flags().StringP("output", "o", "text", "Output format, text, json or sarif")
+	lintCmd.Flags().String("fail-on", "error", "Lowest severity that fails the lint, info, warning, error or none")
+}
+
+// lintDockerfile lints the Dockerfile of a build and fails when a finding
+// is at or above the configured severity
+func lintDockerfile(cmd *cobra.Command, cfg *config.Lint, dockerFile string, out io.Writer) error {
+	skip := cfg.Skip
+	if cmd.Flags().Changed("skip-lint") {
+		skip, _ = cmd.Flags().GetBool("skip-lint")
+	}
+	if skip {
+		return nil
+	}
+	findings, err := lint.Lint(dockerFile, cfg)
+	if err != nil {
+		return err
+	}
+	if err := lint.Print(out, findings, "text"); err != nil {
+		return err
+	}
+	failOn, fail, err := lint.FailOn(cfg)
+	if err != nil {
+		return err
+	}
+	if fail && lint.Failed(findings, failOn) {
+		return fmt.Errorf("%s has lint findings of severity %s or above, fix them or use --skip-lint", dockerFile, failOn)
+	}
+	return nil
+}
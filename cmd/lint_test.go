@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// captureStdout returns what run writes to stdout
+func captureStdout(t *testing.T, run func()) []byte {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	done := make(chan []byte)
+	go func() {
+		var out bytes.Buffer
+		io.Copy(&out, r)
+		done <- out.Bytes()
+	}()
+	run()
+	w.Close()
+	return <-done
+}
+
+func TestLintStdoutIsOnlyTheReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dev-tool-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the user config is created in and read from the home directory
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", dir)
+	defer os.Setenv("HOME", home)
+	dockerFile := filepath.Join(dir, "Dockerfile")
+	if err := ioutil.WriteFile(dockerFile, []byte("FROM alpine\nADD app /app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, output := range []string{"json", "sarif"} {
+		out := captureStdout(t, func() {
+			rootCmd.SetArgs([]string{"image", "lint", "--file", dockerFile, "--output", output, "--fail-on", "none"})
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+		})
+		dec := json.NewDecoder(bytes.NewReader(out))
+		var report interface{}
+		if err := dec.Decode(&report); err != nil {
+			t.Fatalf("%s output is not json: %s\n%s", output, err, out)
+		}
+		if rest, _ := ioutil.ReadAll(dec.Buffered()); len(bytes.TrimSpace(rest)) > 0 {
+			t.Errorf("%s output has more than the report: %s", output, rest)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/cldmnky/dev-tool/pkg/image"
+	"github.com/cldmnky/dev-tool/pkg/registry"
+	"github.com/docker/distribution/reference"
+	"github.com/spf13/cobra"
+)
+
+// promoteCmd represents the promote command
+var promoteCmd = &cobra.Command{
+	Use:   "promote <image>:<tag>",
+	Short: "Promote an image between environments",
+	Long: `Copy an image from the registry of one environment to the registry of
+another by digest, without rebuilding or pulling it locally. The registries
+and their credentials are taken from the registries with an environment in
+the config, a registry may set its own repository.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := getConfig()
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		if from == "" || to == "" {
+			log.Fatalf("--from and --to are required")
+		}
+		fromRegistry, err := getEnvironmentRegistry(cfg, from)
+		if err != nil {
+			log.Fatal(err)
+		}
+		toRegistry, err := getEnvironmentRegistry(cfg, to)
+		if err != nil {
+			log.Fatal(err)
+		}
+		name, ref := splitImage(args[0])
+		if ref == "" {
+			log.Fatalf("%s needs a tag or digest", args[0])
+		}
+		tag := ref
+		if t, _ := cmd.Flags().GetString("tag"); t != "" {
+			tag = t
+		} else if strings.Contains(ref, ":") {
+			log.Fatalf("Promoting by digest needs --tag")
+		}
+
+		source, err := promoteImage(fromRegistry, &cfg.Repo, name, ref)
+		if err != nil {
+			log.Fatalf("Invalid image: %s", err)
+		}
+		target, err := promoteImage(toRegistry, &cfg.Repo, name, tag)
+		if err != nil {
+			log.Fatalf("Invalid image: %s", err)
+		}
+		src, err := registry.NewClient(source.Domain, []config.Registry{fromRegistry})
+		if err != nil {
+			log.Fatal(err)
+		}
+		dst, err := registry.NewClient(target.Domain, []config.Registry{toRegistry})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx, cancel := signalContext()
+		defer cancel()
+		ctx, timeoutCancel := context.WithTimeout(ctx, getTimeout(cmd, "timeout", cfg.Repo.Build.PushTimeout))
+		defer timeoutCancel()
+		fmt.Fprintf(os.Stderr, "Promoting %s/%s:%s to %s/%s:%s\n", source.Domain, source.Repository, ref, target.Domain, target.Repository, tag)
+		digest, err := registry.Copy(ctx, src, source.Repository, source.Reference, dst, target.Repository, tag, os.Stderr)
+		if err != nil {
+			log.Fatalf("promote error - %s", err)
+		}
+		fmt.Printf("Promoted %s/%s@%s\n", target.Domain, target.Repository, digest)
+	},
+}
+
+func init() {
+	imageCmd.AddCommand(promoteCmd)
+	promoteCmd.Flags().String("from", "", "Environment to promote from, i.e. test")
+	promoteCmd.Flags().String("to", "", "Environment to promote to, i.e. prod")
+	promoteCmd.Flags().String("tag", "", "Tag in the target registry (default is the source tag)")
+	promoteCmd.Flags().Duration("timeout", defaultTimeout, "Timeout for the copy")
+}
+
+// getEnvironmentRegistry returns the registry of an environment
+func getEnvironmentRegistry(cfg *config.Config, environment string) (config.Registry, error) {
+	for _, r := range cfg.Registries {
+		if r.Environment == environment {
+			return r, nil
+		}
+	}
+	return config.Registry{}, fmt.Errorf("No registry for environment %s in config", environment)
+}
+
+// splitImage splits name:tag or name@digest
+func splitImage(arg string) (string, string) {
+	if i := strings.Index(arg, "@"); i >= 0 {
+		return arg[:i], arg[i+1:]
+	}
+	if i := strings.LastIndex(arg, ":"); i > strings.LastIndex(arg, "/") {
+		return arg[:i], arg[i+1:]
+	}
+	return arg, ""
+}
+
+// promoteImage returns the image in the registry of an environment, the
+// repository of the registry overrides the repo repository
+func promoteImage(r config.Registry, repo *config.Repo, name string, ref string) (*registry.Image, error) {
+	named, err := reference.ParseNormalizedNamed(name)
+	if err != nil {
+		return nil, err
+	}
+	// the registries come from the environments, a name that has one would
+	// end up with two
+	if reference.Domain(named) != "docker.io" || strings.HasPrefix(name, "docker.io/") || strings.HasPrefix(name, "index.docker.io/") {
+		return nil, fmt.Errorf("%s must not contain a registry, it is taken from the environment", name)
+	}
+	repository := repo.Repository
+	if r.Repository != "" {
+		repository = r.Repository
+	}
+	full, err := image.Reference(r.Host, repository, name, "")
+	if err != nil {
+		return nil, err
+	}
+	img, err := registry.ParseImage(full)
+	if err != nil {
+		return nil, err
+	}
+	img.Reference = ref
+	return img, nil
+}
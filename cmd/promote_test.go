@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+)
+
+func TestPromoteImage(t *testing.T) {
+	repo := &config.Repo{Repository: "team"}
+	tests := []struct {
+		name     string
+		registry config.Registry
+		image    string
+		want     string
+	}{
+		{
+			name:     "repo repository",
+			registry: config.Registry{Host: "test.example.com"},
+			image:    "app",
+			want:     "test.example.com/team/app",
+		},
+		{
+			name:     "repository of the environment",
+			registry: config.Registry{Host: "prod.example.com", Repository: "prod/team"},
+			image:    "app",
+			want:     "prod.example.com/prod/team/app",
+		},
+		{
+			name:     "name with a path",
+			registry: config.Registry{Host: "test.example.com"},
+			image:    "tools/app",
+			want:     "test.example.com/team/tools/app",
+		},
+		{name: "name with a registry", registry: config.Registry{Host: "test.example.com"}, image: "test.example.com/team/app"},
+		{name: "name with docker hub", registry: config.Registry{Host: "test.example.com"}, image: "docker.io/team/app"},
+		{name: "name with a port", registry: config.Registry{Host: "test.example.com"}, image: "localhost:5000/app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := promoteImage(tt.registry, repo, tt.image, "v1")
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("promoted %s/%s, want an error", img.Domain, img.Repository)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := img.Domain + "/" + img.Repository; got != tt.want || img.Reference != "v1" {
+				t.Errorf("image = %s:%s, want %s:v1", got, img.Reference, tt.want)
+			}
+		})
+	}
+}
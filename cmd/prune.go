@@ -0,0 +1,141 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/cldmnky/dev-tool/pkg/image"
+	"github.com/cldmnky/dev-tool/pkg/kube"
+	units "github.com/docker/go-units"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+)
+
+const defaultKeep = 3
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove stale images built by dev-tool",
+	Long: `Remove local images built by dev-tool. The most recent images of every
+repository are kept, as are images used by pods in the configured clusters and
+the clusters set up with rancher setup.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := getConfig()
+		keep, _ := cmd.Flags().GetInt("keep")
+		if keep < 0 {
+			log.Fatalf("--keep must not be negative: %d", keep)
+		}
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		engine, err := getEngine(cmd, cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cli, err := image.NewEngineClient(engine)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ctx, cancel := signalContext()
+		defer cancel()
+
+		images, err := image.BuiltImages(ctx, cli)
+		if err != nil {
+			log.Fatal(err)
+		}
+		deployed := []string{}
+		if skip, _ := cmd.Flags().GetBool("skip-deployed"); !skip {
+			namespace, _ := cmd.Flags().GetString("namespace")
+			deployed, err = deployedImages(ctx, cfg, namespace)
+			if err != nil {
+				log.Fatalf("%s, use --skip-deployed to prune without checking the clusters", err)
+			}
+		}
+		removals := image.PlanPrune(images, keep, deployed)
+		fmt.Fprintf(os.Stderr, "Found %d images built by dev-tool, keeping %d per repository\n", len(images), keep)
+		if dryRun {
+			for _, removal := range removals {
+				image.PrintRemoval(os.Stdout, removal, true)
+			}
+			fmt.Printf("Would reclaim %s\n", units.HumanSize(float64(image.Reclaimed(removals))))
+			return
+		}
+		freed, err := image.RemoveImages(ctx, cli, removals, os.Stdout)
+		fmt.Printf("Reclaimed %s\n", units.HumanSize(float64(freed)))
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	imageCmd.AddCommand(pruneCmd)
+	pruneCmd.Flags().Int("keep", defaultKeep, "Number of most recent images to keep per repository")
+	pruneCmd.Flags().Bool("dry-run", false, "Show what would be removed and the space reclaimed")
+	pruneCmd.Flags().Bool("skip-deployed", false, "Do not look up the images deployed in the clusters")
+	pruneCmd.Flags().StringP("namespace", "n", "", "Only keep the images deployed in this namespace (default is all namespaces)")
+}
+
+// deployedImages returns the images used by pods in every cluster with a
+// kubeconfig
+func deployedImages(ctx context.Context, cfg *config.Config, namespace string) ([]string, error) {
+	kubeconfigs, err := getKubeConfigs(cfg)
+	if err != nil {
+		return nil, err
+	}
+	deployed := []string{}
+	for _, kubeconfig := range kubeconfigs {
+		images, err := kube.DeployedImages(ctx, kubeconfig, namespace)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "Found %d deployed images in %s\n", len(images), kubeconfig)
+		deployed = append(deployed, images...)
+	}
+	return deployed, nil
+}
+
+// getKubeConfigs returns the kubeconfig of every cluster in the config and
+// those written by rancher setup
+func getKubeConfigs(cfg *config.Config) ([]string, error) {
+	kubeconfigs := []string{}
+	for _, cluster := range cfg.Kubernetes.Clusters {
+		if cluster.KubeConfig == "" {
+			continue
+		}
+		path, err := homedir.Expand(cluster.KubeConfig)
+		if err != nil {
+			return nil, err
+		}
+		kubeconfigs = append(kubeconfigs, path)
+	}
+	files, err := ioutil.ReadDir(kubeConfigDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, f := range files {
+		if !f.IsDir() {
+			kubeconfigs = append(kubeconfigs, filepath.Join(kubeConfigDir(), f.Name()))
+		}
+	}
+	return kubeconfigs, nil
+}
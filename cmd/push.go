@@ -0,0 +1,59 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// pushCmd represents the push command
+var pushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Push a docker image",
+	Long:  `Push the docker images tagged for the current commit to its registry.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := getConfig()
+		refs, _, err := getImageReferences(cmd, &config.Repo)
+		if err != nil {
+			log.Fatalf("Error getting image name: %s", err)
+		}
+		builder, err := getBuilder(cmd, config, &config.Repo.Build)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ctx, cancel := signalContext()
+		defer cancel()
+		ctx, timeoutCancel := context.WithTimeout(ctx, getTimeout(cmd, "timeout", config.Repo.Build.PushTimeout))
+		defer timeoutCancel()
+		for _, ref := range refs {
+			digest, err := builder.Push(ctx, ref, os.Stderr)
+			if err != nil {
+				log.Fatalf("push error - %s", err)
+			}
+			fmt.Printf("Pushed %s: %s\n", ref, digest)
+		}
+	},
+}
+
+func init() {
+	imageCmd.AddCommand(pushCmd)
+	pushCmd.Flags().Duration("timeout", defaultTimeout, "Timeout for the push")
+}
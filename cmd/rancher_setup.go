@@ -17,18 +17,15 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
-	"github.com/cldmnky/dev-tool/pkg/config"
 	"github.com/cldmnky/dev-tool/pkg/rancher"
 	"github.com/spf13/cobra"
 )
 
-type setupOptions struct {
-	config *config.RancherCluster
-}
-
 // setupCmd represents the setup command
 var setupCmd = &cobra.Command{
 	Use:   "setup",
@@ -39,47 +36,69 @@ var setupCmd = &cobra.Command{
 		cluster, _ := cmd.Parent().Flags().GetString("cluster")
 		project, _ := cmd.Parent().Flags().GetString("project")
 		namespace, _ := cmd.Parent().Flags().GetString("namespace")
-		o := &setupOptions{}
-		r := getRancher(env)
-		o.config = r
-		rancher, err := rancher.GetClient(o.config.URL, o.config.Token)
-		if err != nil {
-			fmt.Printf("%s", err)
-		}
-		p, err := rancher.EnsureProject(cluster, project)
-		if err != nil {
-			fmt.Printf("%s", err)
-			os.Exit(1)
-		}
-		fmt.Printf("Rancher project setup: %s\n", p.ID)
-		n, err := rancher.EnsureNamespace(namespace, cluster, project)
-		if err != nil {
-			fmt.Printf("%s", err)
-			os.Exit(1)
-		}
-		fmt.Printf("Project namespace setup: %s\n", n.ID)
-		fmt.Printf("Generating kubeconfig for %s", cluster)
-		currentCluster, err := rancher.GetCluster(cluster)
-		if err != nil {
-			fmt.Printf("%s", err)
-			os.Exit(1)
-		}
-		kubeConfig, err := rancher.GetKubeConfig(currentCluster)
+		kubeConfig, err := setupRancher(os.Stdout, env, cluster, project, namespace)
 		if err != nil {
-			fmt.Printf("%s", err)
-			os.Exit(1)
-		}
-		// write kubeconfig
-		home := getHomeDir()
-		if err = os.Mkdir(fmt.Sprintf("%s/%s/kubeconfig", home, configDir), 0700); err != nil {
-			fmt.Printf("%s", err)
+			fmt.Printf("%s\n", err)
 			os.Exit(1)
 		}
-		ioutil.WriteFile(fmt.Sprintf("%s/%s/kubeconfig/%s", home, configDir, cluster), []byte(kubeConfig), 0600)
-
+		fmt.Printf("Wrote kubeconfig %s\n", kubeConfig)
 	},
 }
 
 func init() {
 	rancherCmd.AddCommand(setupCmd)
 }
+
+// setupRancher creates the project and namespace in the cluster of the
+// environment when they are missing and writes the kubeconfig of the
+// cluster, its path is returned
+func setupRancher(out io.Writer, env string, cluster string, project string, namespace string) (string, error) {
+	r := getRancher(env)
+	client, err := rancher.GetClient(r.URL, r.Token)
+	if err != nil {
+		return "", err
+	}
+	p, err := client.EnsureProject(cluster, project)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(out, "Rancher project setup: %s\n", p.ID)
+	n, err := client.EnsureNamespace(namespace, cluster, project)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(out, "Project namespace setup: %s\n", n.ID)
+	return writeKubeConfig(out, client, cluster)
+}
+
+// rancherKubeConfig writes the kubeconfig of a cluster of the environment
+// without changing the cluster, its path is returned
+func rancherKubeConfig(out io.Writer, env string, cluster string) (string, error) {
+	r := getRancher(env)
+	client, err := rancher.GetClient(r.URL, r.Token)
+	if err != nil {
+		return "", err
+	}
+	return writeKubeConfig(out, client, cluster)
+}
+
+func writeKubeConfig(out io.Writer, client *rancher.RancherClient, cluster string) (string, error) {
+	fmt.Fprintf(out, "Generating kubeconfig for %s\n", cluster)
+	currentCluster, err := client.GetCluster(cluster)
+	if err != nil {
+		return "", err
+	}
+	kubeConfig, err := client.GetKubeConfig(currentCluster)
+	if err != nil {
+		return "", err
+	}
+	// write kubeconfig
+	if err := os.MkdirAll(kubeConfigDir(), 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(kubeConfigDir(), cluster)
+	if err := ioutil.WriteFile(path, []byte(kubeConfig), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/cldmnky/dev-tool/pkg/helm"
+	"github.com/spf13/cobra"
+)
+
+// rollbackCmd represents the rollback command
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [revision]",
+	Short: "Roll the release back to a revision",
+	Long: `Roll the helm release of the repo in an environment back to a revision, the
+previous one when no revision is given, and wait for the rollout. The
+revisions are listed by history.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := getConfig()
+		revision := 0
+		if len(args) == 1 {
+			r, err := strconv.Atoi(args[0])
+			if err != nil || r < 1 {
+				log.Fatalf("Invalid revision: %s", args[0])
+			}
+			revision = r
+		}
+		env, release, err := getRelease(cmd, cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		runner, err := releaseRunner(env)
+		if err != nil {
+			log.Fatal(err)
+		}
+		target := "the previous revision"
+		if revision > 0 {
+			target = fmt.Sprintf("revision %d", revision)
+		}
+		fmt.Fprintf(os.Stderr, "Rolling back %s in %s/%s to %s\n", release, env.Cluster, env.Namespace, target)
+		wait, _ := cmd.Flags().GetBool("wait")
+		err = runner.Rollback(release, revision, &helm.Options{
+			Wait:    wait,
+			Timeout: getTimeout(cmd, "timeout", cfg.Repo.Deploy.Timeout),
+		})
+		if err != nil {
+			log.Fatalf("rollback error - %s", err)
+		}
+		rel, err := runner.Status(release)
+		if err != nil {
+			log.Fatal(err)
+		}
+		r := helm.Summarize(rel)
+		fmt.Printf("Release: %s\n", rel.Name)
+		fmt.Printf("Revision: %d\n", r.Version)
+		fmt.Printf("Image tag: %s\n", r.Tag)
+		if r.Commit != "" {
+			fmt.Printf("Commit: %s\n", r.Commit)
+		}
+		fmt.Printf("Status: %s\n", r.Status)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+	addReleaseFlags(rollbackCmd)
+	addImageNameFlags(rollbackCmd.Flags())
+	rollbackCmd.Flags().Bool("wait", true, "Wait until the resources of the release are ready")
+	rollbackCmd.Flags().Duration("timeout", defaultTimeout, "Timeout for the rollback")
+}
@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/cldmnky/dev-tool/pkg/config"
 	"github.com/spf13/cobra"
@@ -61,7 +63,7 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.dev-tool/dev-tool.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.dev-tool/dev-tool.yaml), a dev-tool.yaml in the working directory is merged on top")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -87,13 +89,64 @@ func initConfig() {
 
 	// If a config file is found, read it in, else create it
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	} else {
 		if err := createDefaultConfig(configFileName); err != nil {
-			fmt.Printf("Error creating config file: %s", err)
+			fmt.Fprintf(os.Stderr, "Error creating config file: %s\n", err)
 			os.Exit(1)
 		}
 	}
+	if err := mergeRepoConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// mergeRepoConfig merges the dev-tool.yaml in the working directory, the repo
+// level config kept next to the source, on top of the user config
+func mergeRepoConfig() error {
+	path, err := filepath.Abs(configFileName)
+	if err != nil {
+		return nil
+	}
+	if used, err := filepath.Abs(viper.ConfigFileUsed()); err == nil && used == path {
+		return nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	repo := viper.New()
+	repo.SetConfigFile(path)
+	if err := repo.ReadInConfig(); err != nil {
+		return fmt.Errorf("Could not read repo config %s: %s", path, err)
+	}
+	if err := viper.MergeConfigMap(repo.AllSettings()); err != nil {
+		return fmt.Errorf("Could not merge repo config %s: %s", path, err)
+	}
+	fmt.Fprintln(os.Stderr, "Using repo config file:", path)
+	return nil
+}
+
+// reloadConfig reads the config again after changing into a checkout, so
+// that the repo config of the checkout replaces the one of the worktree in
+// dir
+func reloadConfig(dir string) error {
+	switch used := viper.ConfigFileUsed(); {
+	case used == "":
+		// no user config, start from an empty one
+		viper.SetConfigType("yaml")
+		if err := viper.ReadConfig(strings.NewReader("")); err != nil {
+			return err
+		}
+		return mergeRepoConfig()
+	case used == filepath.Join(dir, configFileName):
+		// the repo config of the worktree was the only config
+		viper.SetConfigFile(configFileName)
+	}
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("Could not read config: %s", err)
+	}
+	return mergeRepoConfig()
 }
 
 func getHomeDir() string {
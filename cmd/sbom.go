@@ -0,0 +1,130 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/cldmnky/dev-tool/pkg/git"
+	"github.com/cldmnky/dev-tool/pkg/image"
+	"github.com/cldmnky/dev-tool/pkg/registry"
+	"github.com/cldmnky/dev-tool/pkg/sbom"
+	"github.com/spf13/cobra"
+)
+
+// getSBOMFormat returns the SBOM format of the build, --sbom overrides the
+// build config. An empty format disables the SBOM.
+func getSBOMFormat(cmd *cobra.Command, build *config.Build, push bool) (string, error) {
+	format := build.SBOM
+	if cmd.Flags().Changed("sbom") {
+		format, _ = cmd.Flags().GetString("sbom")
+	}
+	switch format {
+	case "", "spdx", "cyclonedx":
+	default:
+		return "", fmt.Errorf("Unknown SBOM format: %s", format)
+	}
+	attach, _ := cmd.Flags().GetBool("sbom-attach")
+	if attach {
+		if !push {
+			return "", fmt.Errorf("--sbom-attach requires --push")
+		}
+		if format == "" {
+			return "", fmt.Errorf("--sbom-attach requires an SBOM format")
+		}
+	}
+	return format, nil
+}
+
+// writeSBOM scans the layers of the built image for OS packages and Go
+// modules and writes the SBOM to the --sbom-dir. With --sbom-attach the SBOM
+// is pushed next to the image, referring to its digest.
+func writeSBOM(ctx context.Context, cmd *cobra.Command, builder image.Builder, registries []config.Registry, format string, ref string, info *git.Info, buildOpts *image.BuildOptions, result *image.Result) error {
+	out := buildOpts.Output
+	if result.ID == "" {
+		fmt.Fprintf(out, "Not generating an SBOM, %s is not available locally\n", ref)
+		return nil
+	}
+	layers := []*sbom.Layer{}
+	err := builder.Layers(ctx, ref, func(r io.Reader) error {
+		layer, err := sbom.ScanLayer(r)
+		if err != nil {
+			return err
+		}
+		layers = append(layers, layer)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Could not scan %s: %s", ref, err)
+	}
+
+	doc := &sbom.Document{
+		Image:   ref,
+		Digest:  result.ID,
+		Created: time.Now(),
+	}
+	if i := strings.Index(result.Digest, "@"); i >= 0 {
+		doc.Digest = result.Digest[i+1:]
+	}
+	if buildOpts.Reproducible && info != nil {
+		doc.Created = info.CommitTime
+	}
+	doc.Distro, doc.Packages = sbom.Merge(layers)
+	var content bytes.Buffer
+	if err := doc.Write(&content, format); err != nil {
+		return err
+	}
+
+	dir, _ := cmd.Flags().GetString("sbom-dir")
+	img, err := registry.ParseImage(ref)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// the services of a repo often share the last path element, name the
+	// file by the full repository
+	file := filepath.Join(dir, strings.ReplaceAll(img.Repository, "/", "_")+sbom.Extension(format))
+	if err := ioutil.WriteFile(file, content.Bytes(), 0644); err != nil {
+		return err
+	}
+	result.SBOM = file
+	fmt.Fprintf(out, "Wrote SBOM with %d packages to %s\n", len(doc.Packages), file)
+
+	if attach, _ := cmd.Flags().GetBool("sbom-attach"); !attach || result.Digest == "" {
+		return nil
+	}
+	client, err := registry.NewClient(img.Domain, registries)
+	if err != nil {
+		return err
+	}
+	artifact, err := client.AttachArtifact(ctx, img.Repository, doc.Digest, sbom.MediaType(format), "sbom", content.Bytes())
+	if err != nil {
+		return fmt.Errorf("Could not attach SBOM to %s: %s", result.Digest, err)
+	}
+	fmt.Fprintf(out, "Attached SBOM %s\n", artifact)
+	return nil
+}
@@ -1,16 +1,34 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-func getRancher(environment string) *config.RancherCluster {
+const defaultTimeout = 5 * time.Minute
+
+func getConfig() *config.Config {
 	config := &config.Config{}
-	viper.Unmarshal(config)
+	if err := viper.Unmarshal(config); err != nil {
+		fmt.Printf("Could not read config: %s\n", err)
+		os.Exit(1)
+	}
+	return config
+}
+
+func getRancher(environment string) *config.RancherCluster {
+	config := getConfig()
 
 	found := false
 	for _, cluster := range config.Rancher.Clusters {
@@ -25,3 +43,68 @@ func getRancher(environment string) *config.RancherCluster {
 	}
 	return nil
 }
+
+// kubeConfigDir is where rancher setup writes the kubeconfig of a cluster
+func kubeConfigDir() string {
+	return fmt.Sprintf("%s/%s/kubeconfig", getHomeDir(), configDir)
+}
+
+// signalContext returns a context that is cancelled on SIGINT or SIGTERM
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			fmt.Fprintf(os.Stderr, "received %s, cancelling\n", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
+
+// getTimeout returns the duration of the flag if set, else the configured
+// duration or the default
+func getTimeout(cmd *cobra.Command, flag string, configured string) time.Duration {
+	if cmd.Flags().Changed(flag) {
+		timeout, _ := cmd.Flags().GetDuration(flag)
+		return timeout
+	}
+	if configured != "" {
+		timeout, err := time.ParseDuration(configured)
+		if err != nil {
+			fmt.Printf("Invalid timeout in config: %s\n", configured)
+			os.Exit(1)
+		}
+		return timeout
+	}
+	return defaultTimeout
+}
+
+// prefixWriter prefixes every line with the name of a build, lines of
+// concurrent builds sharing mu are not interleaved
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			return len(p), nil
+		}
+		if i > 0 {
+			w.mu.Lock()
+			fmt.Fprintf(w.out, "%s%s\n", w.prefix, w.buf[:i])
+			w.mu.Unlock()
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
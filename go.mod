@@ -6,22 +6,30 @@ replace k8s.io/client-go => k8s.io/client-go v0.18.9
 
 require (
 	github.com/Azure/go-ansiterm v0.0.0-20170929234023-d6e3b3328b78 // indirect
+	github.com/Masterminds/semver/v3 v3.1.0
 	github.com/Microsoft/hcsshim v0.8.10 // indirect
 	github.com/containerd/containerd v1.4.1 // indirect
 	github.com/containerd/continuity v0.0.0-20200928162600-f2cc35102c2a // indirect
-	github.com/docker/distribution v2.7.1+incompatible // indirect
+	github.com/docker/distribution v2.7.1+incompatible
 	github.com/docker/docker v17.12.0-ce-rc1.0.20200531234253-77e06fda0c94+incompatible
 	github.com/docker/go-connections v0.4.0 // indirect
+	github.com/docker/go-units v0.4.0
 	github.com/go-git/go-git/v5 v5.2.0
 	github.com/gorilla/mux v1.8.0 // indirect
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/morikuni/aec v1.0.0 // indirect
-	github.com/opencontainers/image-spec v1.0.1 // indirect
+	github.com/opencontainers/go-digest v1.0.0
+	github.com/opencontainers/image-spec v1.0.1
 	github.com/opencontainers/runc v1.0.0-rc9 //indirect
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/rancher/cli v2.2.0+incompatible
 	github.com/rancher/norman v0.0.0-20200930000340-693d65aaffe3
 	github.com/rancher/types v0.0.0-20201022171446-1df760cc0093
 	github.com/spf13/cobra v1.0.0
+	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.7.1
 	gopkg.in/yaml.v2 v2.3.0
+	helm.sh/helm/v3 v3.3.4
+	k8s.io/apimachinery v0.18.9
+	k8s.io/client-go v12.0.0+incompatible
 )
@@ -1,5 +1,11 @@
 package config
 
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
 // Config defines the config
 type Config struct {
 	Rancher struct {
@@ -8,6 +14,11 @@ type Config struct {
 	Kubernetes struct {
 		Clusters []KubernetesCluster `yaml:"clusters"`
 	} `yaml:"kubernetes"`
+	Registries []Registry `yaml:"registries"`
+	// Engines are the container engines to build with, selected with
+	// --engine or DEV_TOOL_ENGINE
+	Engines []Engine `yaml:"engines"`
+	Repo    Repo     `yaml:"repo"`
 }
 
 type RancherCluster struct {
@@ -20,3 +31,235 @@ type KubernetesCluster struct {
 	ClusterName string `yaml:"clustername"`
 	KubeConfig  string `yaml:"kubeconfig"`
 }
+
+// Registry defines credentials for a container registry, these take
+// precedence over the credentials found in the docker config
+type Registry struct {
+	Host     string `yaml:"host"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Insecure uses plain http, registries on localhost always do
+	Insecure bool `yaml:"insecure"`
+	// Environment is the environment, i.e. test or prod, served by the
+	// registry, used to promote images between environments
+	Environment string `yaml:"environment"`
+	// Repository overrides the repository of the repo config for images
+	// promoted to or from the environment
+	Repository string `yaml:"repository"`
+}
+
+// Engine defines how to reach a container engine with a docker compatible
+// API
+type Engine struct {
+	// Environment selects the engine, i.e. local, ci or remote
+	Environment string `yaml:"environment"`
+	// Host is the API endpoint, unix:///path, tcp://host:port or
+	// ssh://user@host, the DOCKER_HOST environment is used when empty
+	Host string `yaml:"host"`
+	// CertPath is a directory with ca.pem, cert.pem and key.pem for TLS
+	CertPath string `yaml:"certpath"`
+	// Podman uses the podman API socket when no host is set
+	Podman bool `yaml:"podman"`
+	// APIVersion pins the API version, by default it is negotiated
+	APIVersion string `yaml:"apiversion"`
+}
+
+// Repo defines the repository level settings, typically kept in a
+// dev-tool.yaml next to the source. That file is merged on top of the user
+// config in ~/.dev-tool when dev-tool runs in the directory of the source.
+type Repo struct {
+	Registry   string `yaml:"registry"`
+	Repository string `yaml:"repository"`
+	Image      string `yaml:"image"`
+	Build      Build  `yaml:"build"`
+	Tags       Tags   `yaml:"tags"`
+	// Services are the images of a monorepo, built with image build --all
+	Services []Service `yaml:"services"`
+	// Parallel is the number of services built at the same time
+	Parallel int    `yaml:"parallel"`
+	Lint     Lint   `yaml:"lint"`
+	Deploy   Deploy `yaml:"deploy"`
+}
+
+// Deploy defines how the repo is deployed with helm
+type Deploy struct {
+	// Chart is the path of the helm chart, by default chart
+	Chart string `yaml:"chart"`
+	// Release is the helm release name, by default the image name
+	Release string `yaml:"release"`
+	// Timeout is a duration like 10m, the default is 5m
+	Timeout string `yaml:"timeout"`
+	// Environments are the Rancher locations of the environments, i.e.
+	// test or prod, the Rancher server is taken from rancher.clusters
+	Environments []Environment `yaml:"environments"`
+}
+
+// Environment defines where the repo runs in an environment
+type Environment struct {
+	Name      string `yaml:"name"`
+	Cluster   string `yaml:"cluster"`
+	Project   string `yaml:"project"`
+	Namespace string `yaml:"namespace"`
+	// Values are chart values of the environment, they override the
+	// values files of the chart
+	Values map[string]interface{} `yaml:"values"`
+}
+
+// Service defines an image of a monorepo, its build settings are merged on
+// top of the repo build settings
+type Service struct {
+	Name string `yaml:"name"`
+	// Image defaults to the service name
+	Image string `yaml:"image"`
+	// Path is the directory of the service and the default build context
+	Path  string `yaml:"path"`
+	Build Build  `yaml:"build"`
+	// Watch are additional paths, like shared libraries, whose changes
+	// affect the service
+	Watch []string `yaml:"watch"`
+}
+
+// Build defines the build settings of a repo, flags on image build are
+// merged on top of these
+type Build struct {
+	// Builder is the builder backend, docker or oci for the daemonless
+	// builder of simple Dockerfiles
+	Builder    string `yaml:"builder"`
+	Dockerfile string `yaml:"dockerfile"`
+	Context    string `yaml:"context"`
+	Target     string `yaml:"target"`
+	// Args are build arguments as KEY=VALUE, values are expanded from the
+	// environment and a KEY alone takes its value from the environment. Like
+	// Labels they are lists, the config loader lowercases map keys and splits
+	// them on dots.
+	Args []string `yaml:"args"`
+	// Labels are set on the image as KEY=VALUE
+	Labels  []string `yaml:"labels"`
+	NoCache bool     `yaml:"nocache"`
+	Pull    bool     `yaml:"pull"`
+	Network string   `yaml:"network"`
+	// NoOCILabels disables the org.opencontainers.image labels
+	NoOCILabels bool `yaml:"noocilabels"`
+	// Timeout and PushTimeout are durations like 10m, the default is 5m
+	Timeout     string `yaml:"timeout"`
+	PushTimeout string `yaml:"pushtimeout"`
+	// Reproducible normalizes the build context to the commit time
+	Reproducible bool `yaml:"reproducible"`
+	// SBOM is the format of the software bill of materials written for
+	// every built image, spdx or cyclonedx, empty for none
+	SBOM string `yaml:"sbom"`
+	// SkipExisting skips the build of a clean worktree when the image for
+	// the commit exists, RetagExisting also adds the new tags to it
+	SkipExisting  bool `yaml:"skipexisting"`
+	RetagExisting bool `yaml:"retagexisting"`
+}
+
+// Tags defines the tagging policy for built images. When nothing is enabled
+// images are tagged with the short commit sha.
+type Tags struct {
+	Sha      bool `yaml:"sha"`
+	ShortSha bool `yaml:"shortsha"`
+	// Branch tags with the sanitized branch name
+	Branch bool `yaml:"branch"`
+	// GitTag tags with the git tag pointing at HEAD
+	GitTag bool `yaml:"gittag"`
+	// Semver tags with the version of the nearest version tag, without a
+	// leading v, commits after the tag add the distance and commit as in
+	// 1.2.0_3.gabcdef12
+	Semver bool `yaml:"semver"`
+	// Dirty appends -dirty to every tag when the worktree has changes
+	Dirty bool `yaml:"dirty"`
+	// Latest tags latest on the default branch
+	Latest        bool   `yaml:"latest"`
+	DefaultBranch string `yaml:"defaultbranch"`
+}
+
+// Lint configures the Dockerfile linter run by image lint and image build
+type Lint struct {
+	// Skip disables linting in image build
+	Skip bool `yaml:"skip"`
+	// Disable lists the rule ids to suppress, i.e. DT004
+	Disable []string `yaml:"disable"`
+	// Severity overrides the severity of rules, info, warning or error
+	Severity map[string]string `yaml:"severity"`
+	// FailOn is the lowest severity that fails, error by default or none
+	FailOn string `yaml:"failon"`
+}
+
+// Merge returns the build settings with the non empty settings of o on top
+func (b Build) Merge(o Build) Build {
+	merged := b
+	if o.Builder != "" {
+		merged.Builder = o.Builder
+	}
+	if o.Dockerfile != "" {
+		merged.Dockerfile = o.Dockerfile
+	}
+	if o.Context != "" {
+		merged.Context = o.Context
+	}
+	if o.Target != "" {
+		merged.Target = o.Target
+	}
+	if o.Network != "" {
+		merged.Network = o.Network
+	}
+	if o.Timeout != "" {
+		merged.Timeout = o.Timeout
+	}
+	if o.PushTimeout != "" {
+		merged.PushTimeout = o.PushTimeout
+	}
+	if o.SBOM != "" {
+		merged.SBOM = o.SBOM
+	}
+	merged.NoCache = b.NoCache || o.NoCache
+	merged.Pull = b.Pull || o.Pull
+	merged.NoOCILabels = b.NoOCILabels || o.NoOCILabels
+	merged.Reproducible = b.Reproducible || o.Reproducible
+	merged.SkipExisting = b.SkipExisting || o.SkipExisting
+	merged.RetagExisting = b.RetagExisting || o.RetagExisting
+	// later entries of a key override earlier ones
+	merged.Args = append(append([]string{}, b.Args...), o.Args...)
+	merged.Labels = append(append([]string{}, b.Labels...), o.Labels...)
+	return merged
+}
+
+// BuildArgs returns the build args by name, an arg without a value that is
+// not set in the environment is left out
+func (b Build) BuildArgs() (map[string]string, error) {
+	args := map[string]string{}
+	for _, entry := range b.Args {
+		kv := strings.SplitN(entry, "=", 2)
+		if kv[0] == "" {
+			return nil, fmt.Errorf("Invalid build arg in config: %s", entry)
+		}
+		if len(kv) == 2 {
+			args[kv[0]] = os.ExpandEnv(kv[1])
+			continue
+		}
+		if value, ok := os.LookupEnv(kv[0]); ok {
+			args[kv[0]] = value
+		} else {
+			delete(args, kv[0])
+		}
+	}
+	return args, nil
+}
+
+// ImageLabels returns the labels by key, a KEY alone is an empty label
+func (b Build) ImageLabels() (map[string]string, error) {
+	labels := map[string]string{}
+	for _, entry := range b.Labels {
+		kv := strings.SplitN(entry, "=", 2)
+		if kv[0] == "" {
+			return nil, fmt.Errorf("Invalid label in config: %s", entry)
+		}
+		if len(kv) == 2 {
+			labels[kv[0]] = kv[1]
+		} else {
+			labels[kv[0]] = ""
+		}
+	}
+	return labels, nil
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const repoConfig = `repo:
+  build:
+    args:
+      - NODE_VERSION=14
+      - HOME_DIR=$DEV_TOOL_TEST_HOME
+      - FROM_ENV
+      - MISSING_FROM_ENV
+    labels:
+      - com.example.team=Platform
+      - com.example.empty
+  services:
+    - name: api
+      build:
+        args:
+          - NODE_VERSION=15
+`
+
+// loadConfig reads a dev-tool.yaml like the cli does
+func loadConfig(t *testing.T, content string) *Config {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "dev-tool-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dev-tool.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{}
+	if err := v.Unmarshal(cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestBuildArgsAndLabels(t *testing.T) {
+	os.Setenv("DEV_TOOL_TEST_HOME", "/home/app")
+	os.Setenv("FROM_ENV", "env")
+	defer os.Unsetenv("DEV_TOOL_TEST_HOME")
+	defer os.Unsetenv("FROM_ENV")
+	cfg := loadConfig(t, repoConfig)
+
+	args, err := cfg.Repo.Build.BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantArgs := map[string]string{"NODE_VERSION": "14", "HOME_DIR": "/home/app", "FROM_ENV": "env"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %v, want %v", args, wantArgs)
+	}
+	labels, err := cfg.Repo.Build.ImageLabels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLabels := map[string]string{"com.example.team": "Platform", "com.example.empty": ""}
+	if !reflect.DeepEqual(labels, wantLabels) {
+		t.Errorf("labels = %v, want %v", labels, wantLabels)
+	}
+
+	merged, err := cfg.Repo.Build.Merge(cfg.Repo.Services[0].Build).BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged["NODE_VERSION"] != "15" {
+		t.Errorf("service arg NODE_VERSION = %s, want 15", merged["NODE_VERSION"])
+	}
+}
+
+func TestInvalidBuildArgs(t *testing.T) {
+	if _, err := (Build{Args: []string{"=1"}}).BuildArgs(); err == nil {
+		t.Error("parsed an arg without a name")
+	}
+	if _, err := (Build{Labels: []string{"=x"}}).ImageLabels(); err == nil {
+		t.Error("parsed a label without a key")
+	}
+}
@@ -0,0 +1,198 @@
+package dockerfile
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Instruction is a single Dockerfile instruction
+type Instruction struct {
+	// Cmd is the upper case instruction, i.e. FROM
+	Cmd string
+	// Flags are the leading --name=value arguments
+	Flags map[string]string
+	// Args are the words of the instruction, or the elements of the JSON
+	// array when JSON is set
+	Args []string
+	// Raw is the instruction without the command and flags, continuation
+	// lines joined
+	Raw  string
+	JSON bool
+	// Line is the line the instruction starts on
+	Line int
+}
+
+// ParseFile parses the Dockerfile at path
+func ParseFile(path string) ([]*Instruction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads the instructions of a Dockerfile. Comments and blank lines are
+// skipped and lines ending in a backslash are joined with the next line, like
+// docker comments and blank lines within a continuation are skipped as well.
+func Parse(r io.Reader) ([]*Instruction, error) {
+	instructions := []*Instruction{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	start := 0
+	current := ""
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, "#") || text == "" {
+			continue
+		}
+		if current == "" {
+			start = line
+		}
+		if strings.HasSuffix(text, `\`) {
+			current += strings.TrimSuffix(text, `\`) + " "
+			continue
+		}
+		current += text
+		instruction, err := parseInstruction(current, start)
+		if err != nil {
+			return nil, err
+		}
+		instructions = append(instructions, instruction)
+		current = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(current) != "" {
+		instruction, err := parseInstruction(current, start)
+		if err != nil {
+			return nil, err
+		}
+		instructions = append(instructions, instruction)
+	}
+	return instructions, nil
+}
+
+func parseInstruction(text string, line int) (*Instruction, error) {
+	parts := strings.SplitN(strings.TrimSpace(text), " ", 2)
+	instruction := &Instruction{
+		Cmd:   strings.ToUpper(parts[0]),
+		Flags: map[string]string{},
+		Line:  line,
+	}
+	rest := ""
+	if len(parts) == 2 {
+		rest = strings.TrimSpace(parts[1])
+	}
+	for strings.HasPrefix(rest, "--") {
+		flagParts := strings.SplitN(rest, " ", 2)
+		kv := strings.SplitN(strings.TrimPrefix(flagParts[0], "--"), "=", 2)
+		if len(kv) == 2 {
+			instruction.Flags[kv[0]] = kv[1]
+		} else {
+			instruction.Flags[kv[0]] = ""
+		}
+		rest = ""
+		if len(flagParts) == 2 {
+			rest = strings.TrimSpace(flagParts[1])
+		}
+	}
+	instruction.Raw = rest
+	if strings.HasPrefix(rest, "[") {
+		args := []string{}
+		if err := json.Unmarshal([]byte(rest), &args); err == nil {
+			instruction.Args = args
+			instruction.JSON = true
+			return instruction, nil
+		}
+	}
+	words, err := SplitWords(rest)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %s", line, err)
+	}
+	instruction.Args = words
+	return instruction, nil
+}
+
+// SplitWords splits on whitespace, honoring quotes and backslash escapes
+func SplitWords(s string) ([]string, error) {
+	words := []string{}
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// KeyValues parses the arguments of ENV and LABEL, both the KEY=VALUE form
+// and the legacy KEY VALUE form
+func (i *Instruction) KeyValues() ([][2]string, error) {
+	if len(i.Args) == 0 {
+		return nil, fmt.Errorf("line %d: %s requires arguments", i.Line, i.Cmd)
+	}
+	pairs := [][2]string{}
+	if !strings.Contains(i.Args[0], "=") {
+		if len(i.Args) < 2 {
+			return nil, fmt.Errorf("line %d: %s %s requires a value", i.Line, i.Cmd, i.Args[0])
+		}
+		return append(pairs, [2]string{i.Args[0], strings.Join(i.Args[1:], " ")}), nil
+	}
+	for _, arg := range i.Args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("line %d: invalid %s argument %s", i.Line, i.Cmd, arg)
+		}
+		pairs = append(pairs, [2]string{kv[0], kv[1]})
+	}
+	return pairs, nil
+}
+
+// Command returns the exec form of CMD, ENTRYPOINT and RUN, the shell form is
+// wrapped in /bin/sh -c
+func (i *Instruction) Command() []string {
+	if i.JSON {
+		return i.Args
+	}
+	return []string{"/bin/sh", "-c", i.Raw}
+}
@@ -0,0 +1,136 @@
+package dockerfile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		want       []Instruction
+	}{
+		{
+			name:       "comments and blank lines",
+			dockerfile: "# syntax\n\nFROM alpine:3.12 AS base\n\n# build\nrun make\n",
+			want: []Instruction{
+				{Cmd: "FROM", Args: []string{"alpine:3.12", "AS", "base"}, Raw: "alpine:3.12 AS base", Line: 3},
+				{Cmd: "RUN", Args: []string{"make"}, Raw: "make", Line: 6},
+			},
+		},
+		{
+			name:       "continuation",
+			dockerfile: "FROM scratch\nRUN apk add \\\n    curl \\\n    git\nUSER app\n",
+			want: []Instruction{
+				{Cmd: "FROM", Args: []string{"scratch"}, Raw: "scratch", Line: 1},
+				{Cmd: "RUN", Args: []string{"apk", "add", "curl", "git"}, Raw: "apk add  curl  git", Line: 2},
+				{Cmd: "USER", Args: []string{"app"}, Raw: "app", Line: 5},
+			},
+		},
+		{
+			name:       "blank lines and comments in a continuation",
+			dockerfile: "RUN a \\\n\n  # note\n  b\nCMD c\n",
+			want: []Instruction{
+				{Cmd: "RUN", Args: []string{"a", "b"}, Raw: "a  b", Line: 1},
+				{Cmd: "CMD", Args: []string{"c"}, Raw: "c", Line: 5},
+			},
+		},
+		{
+			name:       "continuation at the end",
+			dockerfile: "EXPOSE 80 \\",
+			want: []Instruction{
+				{Cmd: "EXPOSE", Args: []string{"80"}, Raw: "80", Line: 1},
+			},
+		},
+		{
+			name:       "flags and json",
+			dockerfile: "COPY --chown=1000:1000 --from=build /app /app\nCMD [\"/app\", \"--port\", \"80\"]\n",
+			want: []Instruction{
+				{Cmd: "COPY", Flags: map[string]string{"chown": "1000:1000", "from": "build"}, Args: []string{"/app", "/app"}, Raw: "/app /app", Line: 1},
+				{Cmd: "CMD", Args: []string{"/app", "--port", "80"}, Raw: `["/app", "--port", "80"]`, JSON: true, Line: 2},
+			},
+		},
+		{
+			name:       "quotes",
+			dockerfile: `LABEL description="a b" owner='team x' escaped=a\ b` + "\n",
+			want: []Instruction{
+				{Cmd: "LABEL", Args: []string{"description=a b", "owner=team x", "escaped=a b"}, Raw: `description="a b" owner='team x' escaped=a\ b`, Line: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instructions, err := Parse(strings.NewReader(tt.dockerfile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(instructions) != len(tt.want) {
+				t.Fatalf("parsed %d instructions, want %d", len(instructions), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if want.Flags == nil {
+					want.Flags = map[string]string{}
+				}
+				if got := *instructions[i]; !reflect.DeepEqual(got, want) {
+					t.Errorf("instruction %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseUnterminatedQuote(t *testing.T) {
+	if _, err := Parse(strings.NewReader("FROM scratch\nENV A=\"b\n")); err == nil {
+		t.Error("parsed an unterminated quote")
+	}
+}
+
+func TestKeyValues(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    [][2]string
+		wantErr bool
+	}{
+		{line: "ENV A=1 B=\"two words\"", want: [][2]string{{"A", "1"}, {"B", "two words"}}},
+		{line: "ENV A 1 2", want: [][2]string{{"A", "1 2"}}},
+		{line: "LABEL a=", want: [][2]string{{"a", ""}}},
+		{line: "ENV A", wantErr: true},
+		{line: "ENV A=1 =2", wantErr: true},
+		{line: "ENV", wantErr: true},
+	}
+	for _, tt := range tests {
+		instructions, err := Parse(strings.NewReader(tt.line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := instructions[0].KeyValues()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: parsed %v", tt.line, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	instructions, err := Parse(strings.NewReader("CMD [\"/app\"]\nCMD echo $HOME\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := instructions[0].Command(); !reflect.DeepEqual(got, []string{"/app"}) {
+		t.Errorf("exec form = %v", got)
+	}
+	if got := instructions[1].Command(); !reflect.DeepEqual(got, []string{"/bin/sh", "-c", "echo $HOME"}) {
+		t.Errorf("shell form = %v", got)
+	}
+}
@@ -0,0 +1,144 @@
+package git
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Changes holds the paths changed since a base commit
+type Changes struct {
+	// Root is the root of the worktree, Paths are relative to it
+	Root  string
+	Base  string
+	Paths []string
+}
+
+// ChangedPaths returns the paths changed between base and HEAD, including
+// uncommitted changes in the worktree. Without a base the merge-base of HEAD
+// and the default branch is used, or the parent of HEAD when HEAD is on the
+// default branch.
+func ChangedPaths(path string, base string) (*Changes, error) {
+	r, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+	headCommit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	baseCommit, err := resolveBase(r, headCommit, base)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := &Changes{
+		Root: w.Filesystem.Root(),
+	}
+	paths := map[string]bool{}
+	if baseCommit == nil {
+		// a root commit, everything changed
+		changes.Base = plumbing.ZeroHash.String()
+		files, err := headCommit.Files()
+		if err != nil {
+			return nil, err
+		}
+		err = files.ForEach(func(f *object.File) error {
+			paths[f.Name] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		changes.Base = baseCommit.Hash.String()
+		baseTree, err := baseCommit.Tree()
+		if err != nil {
+			return nil, err
+		}
+		headTree, err := headCommit.Tree()
+		if err != nil {
+			return nil, err
+		}
+		diff, err := baseTree.Diff(headTree)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range diff {
+			for _, name := range []string{change.From.Name, change.To.Name} {
+				if name != "" {
+					paths[name] = true
+				}
+			}
+		}
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return nil, err
+	}
+	for name, s := range status {
+		if s.Worktree != git.Unmodified || s.Staging != git.Unmodified {
+			paths[name] = true
+		}
+	}
+	for name := range paths {
+		changes.Paths = append(changes.Paths, name)
+	}
+	sort.Strings(changes.Paths)
+	return changes, nil
+}
+
+// resolveBase returns the commit to compare HEAD with, nil when HEAD is a
+// root commit on the default branch
+func resolveBase(r *git.Repository, head *object.Commit, base string) (*object.Commit, error) {
+	if base != "" {
+		hash, err := r.ResolveRevision(plumbing.Revision(base))
+		if err != nil {
+			return nil, fmt.Errorf("Could not resolve %s: %s", base, err)
+		}
+		return r.CommitObject(*hash)
+	}
+
+	branch := defaultBranch(r)
+	var hash *plumbing.Hash
+	for _, rev := range []string{"refs/remotes/origin/" + branch, "refs/heads/" + branch} {
+		if h, err := r.ResolveRevision(plumbing.Revision(rev)); err == nil {
+			hash = h
+			break
+		}
+	}
+	if hash == nil {
+		return nil, fmt.Errorf("Could not find the default branch %s, set a base", branch)
+	}
+	defaultCommit, err := r.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+	bases, err := head.MergeBase(defaultCommit)
+	if err != nil {
+		return nil, err
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("HEAD and %s have no common ancestor, set a base", branch)
+	}
+	if bases[0].Hash != head.Hash {
+		return bases[0], nil
+	}
+	// HEAD is on the default branch, compare with the previous commit
+	if head.NumParents() == 0 {
+		return nil, nil
+	}
+	return head.Parent(0)
+}
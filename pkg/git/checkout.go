@@ -0,0 +1,135 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Checkout holds the files of a revision exported to a temporary directory
+type Checkout struct {
+	// Dir is the top level directory of the exported tree, it has the same
+	// name as the top level directory of the repository
+	Dir  string
+	Info *Info
+	tmp  string
+}
+
+// CheckoutRevision exports the tree of the commit rev resolves to, a tag,
+// branch or sha, from the repository at path into a temporary directory.
+// Only committed files are exported, the git metadata is that of rev.
+func CheckoutRevision(path string, rev string) (*Checkout, error) {
+	r, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("Could not resolve %s: %s", rev, err)
+	}
+	info, err := commitInfo(r, *hash)
+	if err != nil {
+		return nil, err
+	}
+	info.Branch = branchName(r, rev)
+
+	root, err := Root(path)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempDir("", "dev-tool-")
+	if err != nil {
+		return nil, err
+	}
+	checkout := &Checkout{
+		Dir:  filepath.Join(tmp, filepath.Base(root)),
+		Info: info,
+		tmp:  tmp,
+	}
+	commit, err := r.CommitObject(*hash)
+	if err == nil {
+		err = export(commit, checkout.Dir)
+	}
+	if err != nil {
+		checkout.Remove()
+		return nil, err
+	}
+	return checkout, nil
+}
+
+// Remove deletes the exported files
+func (c *Checkout) Remove() error {
+	return os.RemoveAll(c.tmp)
+}
+
+// Root returns the top level directory of the worktree containing path
+func Root(path string) (string, error) {
+	r, err := open(path)
+	if err != nil {
+		return "", err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return "", err
+	}
+	return w.Filesystem.Root(), nil
+}
+
+// branchName returns rev when it names a local or origin branch
+func branchName(r *git.Repository, rev string) string {
+	for _, name := range []plumbing.ReferenceName{
+		plumbing.NewBranchReferenceName(rev),
+		plumbing.NewRemoteReferenceName("origin", rev),
+	} {
+		if _, err := r.Reference(name, false); err == nil {
+			return rev
+		}
+	}
+	return ""
+}
+
+// export writes the files of a commit below dir, submodules are skipped
+func export(commit *object.Commit, dir string) error {
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	return tree.Files().ForEach(func(f *object.File) error {
+		target := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if f.Mode == filemode.Symlink {
+			link, err := f.Contents()
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		mode, err := f.Mode.ToOSFileMode()
+		if err != nil {
+			return err
+		}
+		reader, err := f.Reader()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, reader); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
@@ -1,15 +1,51 @@
 package git
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 )
 
+// Info holds the git metadata of a worktree
+type Info struct {
+	// Commit is the full sha of HEAD
+	Commit string
+	// Branch is empty when HEAD is detached
+	Branch string
+	// Tag is set when a tag points at HEAD
+	Tag string
+	// Describe is the nearest tag in the format of git describe --tags,
+	// i.e. v1.2.0-3-gabcdef12, empty when there are no tags. Unlike git the
+	// commit is always abbreviated to the length of ShortCommit.
+	Describe      string
+	DefaultBranch string
+	// Dirty is set when the worktree has uncommitted changes
+	Dirty bool
+	// RemoteURL is the url of the origin remote
+	RemoteURL  string
+	CommitTime time.Time
+	// Author of the HEAD commit, as Name <email>
+	Author string
+}
+
+// shortCommitLength is the length of abbreviated commits, the short sha
+// image tags depend on it
+const shortCommitLength = 8
+
+// ShortCommit returns the abbreviated commit
+func (i *Info) ShortCommit() string {
+	return i.Commit[0:shortCommitLength]
+}
+
 // GetCommit return the current commit
 func GetCommit(path string) (string, error) {
-	opts := git.PlainOpenOptions{
-		DetectDotGit: true,
-	}
-	r, err := git.PlainOpenWithOptions(path, &opts)
+	r, err := open(path)
 	if err != nil {
 		return "", err
 	}
@@ -17,5 +53,160 @@ func GetCommit(path string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return ref.Hash().String()[0:8], nil
+	return ref.Hash().String()[0:shortCommitLength], nil
+}
+
+// GetInfo returns the git metadata for the repository at path
+func GetInfo(path string) (*Info, error) {
+	r, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+	info, err := commitInfo(r, head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	if head.Name().IsBranch() {
+		info.Branch = head.Name().Short()
+	}
+	if info.Dirty, err = isDirty(r); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// commitInfo returns the metadata of a commit, branch and dirty state are
+// left to the caller
+func commitInfo(r *git.Repository, hash plumbing.Hash) (*Info, error) {
+	info := &Info{
+		Commit:        hash.String(),
+		DefaultBranch: defaultBranch(r),
+	}
+	commit, err := r.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	info.CommitTime = commit.Committer.When
+	info.Author = fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email)
+	if remote, err := r.Remote("origin"); err == nil && len(remote.Config().URLs) > 0 {
+		info.RemoteURL = remote.Config().URLs[0]
+	}
+	if info.Tag, info.Describe, err = describe(r, hash); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func open(path string) (*git.Repository, error) {
+	opts := git.PlainOpenOptions{
+		DetectDotGit: true,
+	}
+	return git.PlainOpenWithOptions(path, &opts)
+}
+
+// isDirty checks the worktree for uncommitted changes
+func isDirty(r *git.Repository) (bool, error) {
+	w, err := r.Worktree()
+	if err != nil {
+		return false, err
+	}
+	status, err := w.Status()
+	if err != nil {
+		return false, err
+	}
+	return !status.IsClean(), nil
+}
+
+// defaultBranch returns the branch origin/HEAD points at, falling back to
+// main or master
+func defaultBranch(r *git.Repository) string {
+	ref, err := r.Reference(plumbing.NewRemoteHEADReferenceName("origin"), false)
+	if err == nil && ref.Type() == plumbing.SymbolicReference {
+		return strings.TrimPrefix(ref.Target().String(), "refs/remotes/origin/")
+	}
+	if _, err := r.Reference(plumbing.NewBranchReferenceName("main"), false); err == nil {
+		return "main"
+	}
+	return "master"
+}
+
+// tagsByCommit maps commit hashes to tag names, resolving annotated tags
+func tagsByCommit(r *git.Repository) (map[plumbing.Hash]string, error) {
+	tags := map[plumbing.Hash]string{}
+	iter, err := r.Tags()
+	if err != nil {
+		return nil, err
+	}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		hash := ref.Hash()
+		if tag, err := r.TagObject(hash); err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				// tags of trees and blobs are of no use here
+				return nil
+			}
+			hash = commit.Hash
+		}
+		if name := ref.Name().Short(); higherTag(name, tags[hash]) {
+			tags[hash] = name
+		}
+		return nil
+	})
+	return tags, err
+}
+
+// higherTag returns whether tag is preferred over current when a commit has
+// several tags. Semantic versions are compared by precedence and preferred
+// over other tags, which are compared by name.
+func higherTag(tag string, current string) bool {
+	if current == "" {
+		return true
+	}
+	v, tagErr := ParseSemver(tag)
+	c, currentErr := ParseSemver(current)
+	switch {
+	case tagErr == nil && currentErr == nil:
+		return v.GreaterThan(c)
+	case tagErr == nil:
+		return true
+	case currentErr == nil:
+		return false
+	}
+	return tag > current
+}
+
+// ParseSemver parses a tag as a semantic version, with or without a leading v
+func ParseSemver(tag string) (*semver.Version, error) {
+	return semver.StrictNewVersion(strings.TrimPrefix(tag, "v"))
+}
+
+// describe returns the exact tag of the commit and the nearest tag
+// description in the format of git describe --tags
+func describe(r *git.Repository, hash plumbing.Hash) (string, string, error) {
+	tags, err := tagsByCommit(r)
+	if err != nil || len(tags) == 0 {
+		return "", "", err
+	}
+	if tag, ok := tags[hash]; ok {
+		return tag, tag, nil
+	}
+	commits, err := r.Log(&git.LogOptions{From: hash})
+	if err != nil {
+		return "", "", err
+	}
+	description := ""
+	distance := 0
+	err = commits.ForEach(func(c *object.Commit) error {
+		if tag, ok := tags[c.Hash]; ok {
+			description = fmt.Sprintf("%s-%d-g%s", tag, distance, hash.String()[0:shortCommitLength])
+			return storer.ErrStop
+		}
+		distance++
+		return nil
+	})
+	return "", description, err
 }
@@ -0,0 +1,24 @@
+package git
+
+import "testing"
+
+func TestHigherTag(t *testing.T) {
+	tests := []struct {
+		tag, current string
+		want         bool
+	}{
+		{"v1.0.0", "", true},
+		{"v1.10.0", "v1.9.0", true},
+		{"v1.9.0", "v1.10.0", false},
+		{"1.2.0", "v1.2.0-rc.1", true},
+		{"v1.0.0", "release", true},
+		{"release", "v1.0.0", false},
+		{"stable", "release", true},
+		{"release", "stable", false},
+	}
+	for _, tt := range tests {
+		if got := higherTag(tt.tag, tt.current); got != tt.want {
+			t.Errorf("higherTag(%q, %q) = %v, want %v", tt.tag, tt.current, got, tt.want)
+		}
+	}
+}
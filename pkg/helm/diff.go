@@ -0,0 +1,216 @@
+package helm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v2"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+// Kinds of change of an object
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// diffContext is the number of unchanged lines around a change
+const diffContext = 3
+
+// ignoredLabels change with every chart version or are set by tooling, they
+// are left out of diffs
+var ignoredLabels = []string{
+	"helm.sh/chart",
+	"chart",
+	"app.kubernetes.io/version",
+}
+
+// ignoredMetadata are fields the cluster sets on live objects
+var ignoredMetadata = []string{
+	"creationTimestamp",
+	"generation",
+	"managedFields",
+	"resourceVersion",
+	"selfLink",
+	"uid",
+}
+
+// ObjectDiff is the change of a Kubernetes object between two manifests
+type ObjectDiff struct {
+	// Key identifies the object, Kind/name prefixed by the namespace if set
+	Key string
+	// Change is Added, Removed or Changed
+	Change string
+	// Diff is the unified diff of the object as YAML
+	Diff string
+}
+
+// DiffManifests compares the objects of two rendered manifests, i.e. the
+// deployed release and the upgrade, and returns the objects that differ
+// sorted by key. Labels generated from the chart version and fields set by
+// the cluster are ignored.
+func DiffManifests(current string, next string) ([]ObjectDiff, error) {
+	from, err := manifestObjects(current)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse deployed manifest: %s", err)
+	}
+	to, err := manifestObjects(next)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse new manifest: %s", err)
+	}
+	keys := map[string]bool{}
+	for key := range from {
+		keys[key] = true
+	}
+	for key := range to {
+		keys[key] = true
+	}
+	sorted := []string{}
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	diffs := []ObjectDiff{}
+	for _, key := range sorted {
+		a, inFrom := from[key]
+		b, inTo := to[key]
+		if a == b {
+			continue
+		}
+		change := Changed
+		switch {
+		case !inFrom:
+			change = Added
+		case !inTo:
+			change = Removed
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(a),
+			B:        splitLines(b),
+			FromFile: "deployed",
+			ToFile:   "new",
+			Context:  diffContext,
+		})
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, ObjectDiff{Key: key, Change: change, Diff: diff})
+	}
+	return diffs, nil
+}
+
+// splitLines splits text into lines, none for a missing object
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return difflib.SplitLines(text)
+}
+
+// manifestObjects returns the objects of a manifest as YAML with sorted keys
+// by their key
+func manifestObjects(manifest string) (map[string]string, error) {
+	objects := map[string]string{}
+	for _, doc := range releaseutil.SplitManifests(manifest) {
+		object := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(doc), &object); err != nil {
+			return nil, err
+		}
+		if len(object) == 0 {
+			continue
+		}
+		object = Normalize(object)
+		clean(object)
+		data, err := yaml.Marshal(object)
+		if err != nil {
+			return nil, err
+		}
+		objects[objectKey(object)] = string(data)
+	}
+	return objects, nil
+}
+
+func objectKey(object map[string]interface{}) string {
+	metadata, _ := object["metadata"].(map[string]interface{})
+	key := fmt.Sprintf("%v/%v", object["kind"], metadata["name"])
+	if namespace, ok := metadata["namespace"].(string); ok && namespace != "" {
+		key = namespace + "/" + key
+	}
+	return key
+}
+
+// clean removes the ignored labels and fields of an object, including the
+// labels of a pod template
+func clean(object map[string]interface{}) {
+	delete(object, "status")
+	if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+		for _, field := range ignoredMetadata {
+			delete(metadata, field)
+		}
+		cleanLabels(metadata)
+	}
+	spec, _ := object["spec"].(map[string]interface{})
+	template, _ := spec["template"].(map[string]interface{})
+	if metadata, ok := template["metadata"].(map[string]interface{}); ok {
+		cleanLabels(metadata)
+	}
+}
+
+func cleanLabels(metadata map[string]interface{}) {
+	labels, ok := metadata["labels"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, label := range ignoredLabels {
+		delete(labels, label)
+	}
+	if len(labels) == 0 {
+		delete(metadata, "labels")
+	}
+}
+
+// ANSI colors of diff lines
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+// PrintDiffs writes the diff of every object under a header naming the
+// object and its change, colored for a terminal when color is set
+func PrintDiffs(w io.Writer, diffs []ObjectDiff, color bool) {
+	paint := func(c string, s string) string {
+		if !color {
+			return s
+		}
+		return c + s + colorReset
+	}
+	for _, d := range diffs {
+		fmt.Fprintln(w, paint(colorBold, fmt.Sprintf("%s %s", d.Key, d.Change)))
+		for _, line := range strings.SplitAfter(d.Diff, "\n") {
+			if line == "" {
+				continue
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+				fmt.Fprintln(w, paint(colorBold, line))
+			case strings.HasPrefix(line, "@@"):
+				fmt.Fprintln(w, paint(colorCyan, line))
+			case strings.HasPrefix(line, "+"):
+				fmt.Fprintln(w, paint(colorGreen, line))
+			case strings.HasPrefix(line, "-"):
+				fmt.Fprintln(w, paint(colorRed, line))
+			default:
+				fmt.Fprintln(w, line)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package helm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const deployedManifest = `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+    helm.sh/chart: app-0.1.0
+spec:
+  replicas: 1
+  template:
+    metadata:
+      labels:
+        app: web
+        helm.sh/chart: app-0.1.0
+---
+# Source: app/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+
+const newManifest = `---
+# Source: app/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+  namespace: team
+data:
+  level: debug
+---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+    helm.sh/chart: app-0.2.0
+spec:
+  replicas: 1
+  template:
+    metadata:
+      labels:
+        app: web
+        helm.sh/chart: app-0.2.0
+`
+
+func TestDiffManifests(t *testing.T) {
+	diffs, err := DiffManifests(deployedManifest, newManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the deployment only differs in the chart label
+	want := []struct{ key, change string }{
+		{"Service/web", Removed},
+		{"team/ConfigMap/web", Added},
+	}
+	if len(diffs) != len(want) {
+		t.Fatalf("got %d diffs, want %d: %v", len(diffs), len(want), diffs)
+	}
+	for i, w := range want {
+		if diffs[i].Key != w.key || diffs[i].Change != w.change {
+			t.Errorf("diff %d is %s %s, want %s %s", i, diffs[i].Key, diffs[i].Change, w.key, w.change)
+		}
+	}
+	if !strings.Contains(diffs[1].Diff, "+  level: debug\n") {
+		t.Errorf("diff of the added config map:\n%s", diffs[1].Diff)
+	}
+
+	diffs, err = DiffManifests(newManifest, strings.Replace(newManifest, "replicas: 1", "replicas: 3", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Change != Changed {
+		t.Fatalf("diffs = %v, want the deployment changed", diffs)
+	}
+	if !strings.Contains(diffs[0].Diff, "-  replicas: 1\n+  replicas: 3\n") {
+		t.Errorf("diff of the deployment:\n%s", diffs[0].Diff)
+	}
+}
+
+func TestPrintDiffs(t *testing.T) {
+	diffs, err := DiffManifests("", newManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plain, colored bytes.Buffer
+	PrintDiffs(&plain, diffs, false)
+	PrintDiffs(&colored, diffs, true)
+	if strings.Contains(plain.String(), "\x1b[") {
+		t.Errorf("uncolored diff contains escape codes:\n%s", plain.String())
+	}
+	if !strings.Contains(colored.String(), colorGreen+"+kind: Deployment"+colorReset) {
+		t.Errorf("added lines are not green:\n%q", colored.String())
+	}
+}
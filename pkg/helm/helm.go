@@ -2,95 +2,202 @@ package helm
 
 import (
 	"fmt"
-	"log"
+	"time"
 
-	"github.com/mitchellh/go-homedir"
 	"helm.sh/helm/v3/pkg/action"
-	"k8s.io/client-go/tools/clientcmd"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/storage/driver"
 )
 
-// Runner is a helm runner type
+// storageDriver keeps the releases in secrets, like the helm cli does
+const storageDriver = "secret"
+
+// DefaultTimeout is how long Install, Upgrade and Rollback wait for the
+// resources to become ready
+const DefaultTimeout = 5 * time.Minute
+
+// Runner runs helm actions against the releases of one namespace
 type Runner struct {
-	config *action.Configuration
+	config    *action.Configuration
+	namespace string
 }
 
-// NewHelmClient returns a helm client
-func NewHelmClient(bamespace string) (*Runner, error) {
-	// get a restConfig
-	home, err := homedir.Dir()
-	if err != nil {
-		return nil, err
+// Options defines how a release is installed, upgraded or rolled back
+type Options struct {
+	// Timeout for the operation, DefaultTimeout when zero
+	Timeout time.Duration
+	// Wait for the resources to become ready
+	Wait bool
+	// Atomic rolls back, or uninstalls a new release, on failure
+	Atomic bool
+	// DryRun renders the release without touching the cluster
+	DryRun bool
+	// Install makes Upgrade install a release that does not exist
+	Install bool
+}
+
+// NewRunner returns a runner for the cluster in kubeconfig, i.e. the one
+// written by rancher setup. Releases are installed in and read from
+// namespace, debug receives the helm log and may be nil.
+func NewRunner(kubeconfig string, namespace string, debug func(format string, v ...interface{})) (*Runner, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("No namespace set for helm")
 	}
-	config, err := clientcmd.BuildConfigFromFlags("", fmt.Sprintf("%s/.kube/lab-techops-test-euc1-977445621284", home))
-	if err != nil {
-		log.Fatal(err)
+	if debug == nil {
+		debug = func(format string, v ...interface{}) {}
 	}
-
-	fmt.Printf("Client: %s", config.Host)
-	return nil, nil
+	cfg := &action.Configuration{}
+	if err := cfg.Init(kube.GetConfig(kubeconfig, "", namespace), namespace, storageDriver, debug); err != nil {
+		return nil, fmt.Errorf("Could not initialize helm: %s", err)
+	}
+	return newRunner(cfg, namespace), nil
 }
 
-/*
-usr, err := user.Current()
-if err != nil {
-	panic(err)
+func newRunner(cfg *action.Configuration, namespace string) *Runner {
+	return &Runner{config: cfg, namespace: namespace}
 }
 
-kubeconfig := usr.HomeDir + ".kube/config"
-config, _ := clientcmd.BuildConfigFromFlags("", kubeconfig)
+// LoadChart loads a chart from a directory or an archive
+func LoadChart(path string) (*chart.Chart, error) {
+	ch, err := loader.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load chart %s: %s", path, err)
+	}
+	return ch, nil
+}
 
-runner, err := NewRunner(config, "tfd-namespace", "tfd-namespace")
-if err != nil {
-	panic(err)
+// Install installs a new release of the chart
+func (r *Runner) Install(name string, ch *chart.Chart, values map[string]interface{}, opts *Options) (*release.Release, error) {
+	return r.install(name, ch, values, opts, false)
 }
 
-folderPath, _ := osext.ExecutableFolder()
-chart, err := loader.Load(folderPath + "/helm-charts.tgz")
-if err != nil {
-	panic(err)
+// install installs a release, with replace over an uninstalled release whose
+// history was kept
+func (r *Runner) install(name string, ch *chart.Chart, values map[string]interface{}, opts *Options, replace bool) (*release.Release, error) {
+	opts = withDefaults(opts)
+	install := action.NewInstall(r.config)
+	install.Replace = replace
+	install.ReleaseName = name
+	install.Namespace = r.namespace
+	install.Timeout = opts.Timeout
+	install.Wait = opts.Wait
+	install.Atomic = opts.Atomic
+	install.DryRun = opts.DryRun
+	return install.Run(ch, values)
 }
 
-runner.Install(chart, nil)
+// Upgrade upgrades a release to the chart and values. With opts.Install a
+// missing release is installed and, like helm upgrade --install, an
+// uninstalled release is installed again while a failed one is upgraded.
+func (r *Runner) Upgrade(name string, ch *chart.Chart, values map[string]interface{}, opts *Options) (*release.Release, error) {
+	opts = withDefaults(opts)
+	if opts.Install {
+		history, err := r.History(name)
+		if err == driver.ErrReleaseNotFound {
+			return r.Install(name, ch, values, opts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if last := history[len(history)-1]; last.Info.Status == release.StatusUninstalled {
+			return r.install(name, ch, values, opts, true)
+		}
+	}
+	upgrade := action.NewUpgrade(r.config)
+	upgrade.Namespace = r.namespace
+	upgrade.Timeout = opts.Timeout
+	upgrade.Wait = opts.Wait
+	upgrade.Atomic = opts.Atomic
+	upgrade.DryRun = opts.DryRun
+	return upgrade.Run(name, ch, values)
+}
 
-fmt.Println("Successfully deployed")
+// Render returns the manifest an upgrade, or install, of the release would
+// apply without changing the cluster
+func (r *Runner) Render(name string, ch *chart.Chart, values map[string]interface{}) (string, error) {
+	rel, err := r.Upgrade(name, ch, values, &Options{Install: true, DryRun: true})
+	if err != nil {
+		return "", err
+	}
+	return rel.Manifest, nil
+}
 
+// Deployed returns the deployed revision of a release, nil when the release
+// does not exist or no revision is deployed
+func (r *Runner) Deployed(name string) (*release.Release, error) {
+	history, err := r.History(name)
+	if err == driver.ErrReleaseNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Info.Status == release.StatusDeployed {
+			return history[i], nil
+		}
+	}
+	return nil, nil
 }
 
-// Runner represents a Helm action runner capable of performing Helm
-// operations for a v2beta1.HelmRelease.
-type Runner struct {
-config *action.Configuration
+// Uninstall removes a release and its history
+func (r *Runner) Uninstall(name string) (*release.Release, error) {
+	uninstall := action.NewUninstall(r.config)
+	resp, err := uninstall.Run(name)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Release, nil
 }
 
-// NewRunner constructs a new Runner configured to run Helm actions with the
-// given rest.Config, and the release and storage namespace configured to the
-// provided values.
+// List returns the deployed and failed releases of the namespace
+func (r *Runner) List() ([]*release.Release, error) {
+	list := action.NewList(r.config)
+	list.Deployed = true
+	list.Failed = true
+	list.Pending = true
+	list.SetStateMask()
+	return list.Run()
+}
 
-func NewRunner(clusterCfg *rest.Config, releaseNamespace, storageNamespace string) (*Runner, error) {
-cfg := new(action.Configuration)
-if err := cfg.Init(&genericclioptions.ConfigFlags{
-	APIServer:   &clusterCfg.Host,
-	CAFile:      &clusterCfg.CAFile,
-	BearerToken: &clusterCfg.BearerToken,
-	Namespace:   &releaseNamespace,
-}, storageNamespace, "secret", debugLogger(logger)); err != nil {
-	return nil, err
+// Status returns the latest revision of a release
+func (r *Runner) Status(name string) (*release.Release, error) {
+	return action.NewStatus(r.config).Run(name)
 }
-return &Runner{config: cfg}, nil
+
+// History returns the revisions of a release, oldest first
+func (r *Runner) History(name string) ([]*release.Release, error) {
+	history, err := action.NewHistory(r.config).Run(name)
+	if err != nil {
+		return nil, err
+	}
+	releaseutil.SortByRevision(history)
+	return history, nil
 }
 
-func (r *Runner) Install(chart *chart.Chart, values chartutil.Values) (*release.Release, error) {
-d, _ := time.ParseDuration("10m")
-install := action.NewInstall(r.config)
-install.ReleaseName = "tfd-patient-zero"
-install.Namespace = "tfd-namespace"
-install.Timeout = d
-install.Wait = true
-install.DisableHooks = false
-install.DisableOpenAPIValidation = false
-install.Replace = true
-install.SkipCRDs = true
+// Rollback rolls a release back to a revision, the previous one when
+// revision is zero
+func (r *Runner) Rollback(name string, revision int, opts *Options) error {
+	opts = withDefaults(opts)
+	rollback := action.NewRollback(r.config)
+	rollback.Version = revision
+	rollback.Timeout = opts.Timeout
+	rollback.Wait = opts.Wait
+	rollback.DryRun = opts.DryRun
+	return rollback.Run(name)
+}
 
-return install.Run(chart, values.AsMap())
+func withDefaults(opts *Options) *Options {
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.Timeout == 0 {
+		o.Timeout = DefaultTimeout
+	}
+	return &o
 }
-*/
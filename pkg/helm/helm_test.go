@@ -0,0 +1,268 @@
+package helm
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+const testNamespace = "dev-tool-test"
+
+// testRunner returns a runner that keeps releases in memory and prints the
+// manifests instead of applying them
+func testRunner(t *testing.T) *Runner {
+	t.Helper()
+	memory := driver.NewMemory()
+	memory.SetNamespace(testNamespace)
+	cfg := &action.Configuration{
+		Releases:     storage.Init(memory),
+		KubeClient:   &kubefake.PrintingKubeClient{Out: ioutil.Discard},
+		Capabilities: chartutil.DefaultCapabilities,
+		Log:          t.Logf,
+	}
+	return newRunner(cfg, testNamespace)
+}
+
+func testChart(version string) *chart.Chart {
+	return &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion: chart.APIVersionV2,
+			Name:       "app",
+			Version:    version,
+		},
+		Values: map[string]interface{}{
+			"image": map[string]interface{}{"tag": "latest"},
+		},
+		Templates: []*chart.File{{
+			Name: "templates/configmap.yaml",
+			Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}\ndata:\n  tag: {{ .Values.image.tag | quote }}\n"),
+		}},
+	}
+}
+
+func values(tag string) map[string]interface{} {
+	return map[string]interface{}{
+		"image": map[string]interface{}{"tag": tag},
+	}
+}
+
+func TestInstall(t *testing.T) {
+	r := testRunner(t)
+	rel, err := r.Install("app", testChart("0.1.0"), values("abc"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Namespace != testNamespace {
+		t.Errorf("namespace = %s, want %s", rel.Namespace, testNamespace)
+	}
+	if rel.Info.Status != release.StatusDeployed {
+		t.Errorf("status = %s, want deployed", rel.Info.Status)
+	}
+	if rel.Version != 1 {
+		t.Errorf("revision = %d, want 1", rel.Version)
+	}
+	if _, err := r.Install("app", testChart("0.1.0"), nil, nil); err == nil {
+		t.Error("installing an existing release succeeded")
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	r := testRunner(t)
+	if _, err := r.Upgrade("app", testChart("0.1.0"), values("abc"), nil); err == nil {
+		t.Fatal("upgrading a missing release succeeded")
+	}
+	rel, err := r.Upgrade("app", testChart("0.1.0"), values("abc"), &Options{Install: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Version != 1 {
+		t.Errorf("revision after upgrade --install = %d, want 1", rel.Version)
+	}
+	rel, err = r.Upgrade("app", testChart("0.2.0"), values("def"), &Options{Install: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Version != 2 {
+		t.Errorf("revision = %d, want 2", rel.Version)
+	}
+	if rel.Chart.Metadata.Version != "0.2.0" {
+		t.Errorf("chart version = %s, want 0.2.0", rel.Chart.Metadata.Version)
+	}
+	if tag := rel.Config["image"].(map[string]interface{})["tag"]; tag != "def" {
+		t.Errorf("image.tag = %v, want def", tag)
+	}
+}
+
+func TestUpgradeInstallWithoutDeployedRevision(t *testing.T) {
+	tests := []struct {
+		status release.Status
+		// upgrading needs Install to replace an uninstalled release
+		needsInstall bool
+	}{
+		{release.StatusFailed, false},
+		{release.StatusUninstalled, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status.String(), func(t *testing.T) {
+			r := testRunner(t)
+			rel, err := r.Install("app", testChart("0.1.0"), values("abc"), &Options{DryRun: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rel.Info.Status = tt.status
+			if err := r.config.Releases.Create(rel); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.Upgrade("app", testChart("0.1.0"), values("def"), &Options{DryRun: true}); (err != nil) != tt.needsInstall {
+				t.Errorf("upgrade without install: %v", err)
+			}
+			rel, err = r.Upgrade("app", testChart("0.1.0"), values("def"), &Options{Install: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rel.Version != 2 || rel.Info.Status != release.StatusDeployed {
+				t.Errorf("revision %d %s, want 2 deployed", rel.Version, rel.Info.Status)
+			}
+		})
+	}
+}
+
+func TestHistoryAndRollback(t *testing.T) {
+	r := testRunner(t)
+	if _, err := r.Install("app", testChart("0.1.0"), values("v1"), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"v2", "v3"} {
+		if _, err := r.Upgrade("app", testChart("0.1.0"), values(tag), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := r.Rollback("app", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	history, err := r.History("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 4 {
+		t.Fatalf("history has %d revisions, want 4", len(history))
+	}
+	for i, rel := range history {
+		if rel.Version != i+1 {
+			t.Errorf("history[%d] is revision %d, want %d", i, rel.Version, i+1)
+		}
+	}
+	if history[2].Info.Status != release.StatusSuperseded {
+		t.Errorf("revision 3 status = %s, want superseded", history[2].Info.Status)
+	}
+
+	status, err := r.Status("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Version != 4 {
+		t.Errorf("status revision = %d, want 4", status.Version)
+	}
+	if tag := status.Config["image"].(map[string]interface{})["tag"]; tag != "v1" {
+		t.Errorf("image.tag after rollback = %v, want v1", tag)
+	}
+
+	if _, err := r.History("missing"); err != driver.ErrReleaseNotFound {
+		t.Errorf("history of a missing release: %v, want %v", err, driver.ErrReleaseNotFound)
+	}
+}
+
+func TestListAndUninstall(t *testing.T) {
+	r := testRunner(t)
+	for _, name := range []string{"api", "web"} {
+		if _, err := r.Install(name, testChart("0.1.0"), nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	releases, err := r.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 2 {
+		t.Fatalf("listed %d releases, want 2", len(releases))
+	}
+
+	rel, err := r.Uninstall("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Name != "api" {
+		t.Errorf("uninstalled %s, want api", rel.Name)
+	}
+	releases, err = r.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 1 || releases[0].Name != "web" {
+		t.Errorf("releases after uninstall = %v, want web", releases)
+	}
+	if _, err := r.Status("api"); err == nil {
+		t.Error("status of an uninstalled release succeeded")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	r := testRunner(t)
+	rel, err := r.Install("app", testChart("0.1.0"), values("abc"), &Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel.Manifest == "" {
+		t.Error("dry run rendered no manifest")
+	}
+	if _, err := r.Status("app"); err == nil {
+		t.Error("dry run stored a release")
+	}
+}
+
+func TestNewRunnerNeedsNamespace(t *testing.T) {
+	if _, err := NewRunner("", "", nil); err == nil {
+		t.Error("runner without a namespace was created")
+	}
+}
+
+func TestRenderAndDeployed(t *testing.T) {
+	r := testRunner(t)
+	deployed, err := r.Deployed("app")
+	if err != nil || deployed != nil {
+		t.Fatalf("deployed revision of a missing release = %v, %v", deployed, err)
+	}
+	manifest, err := r.Render("app", testChart("0.1.0"), values("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(manifest, `tag: "abc"`) {
+		t.Errorf("rendered manifest:\n%s", manifest)
+	}
+	if _, err := r.Status("app"); err == nil {
+		t.Error("rendering stored a release")
+	}
+
+	if _, err := r.Install("app", testChart("0.1.0"), values("abc"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Render("app", testChart("0.1.0"), values("def")); err != nil {
+		t.Fatal(err)
+	}
+	deployed, err = r.Deployed("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployed.Version != 1 || !strings.Contains(deployed.Manifest, `tag: "abc"`) {
+		t.Errorf("deployed revision %d:\n%s", deployed.Version, deployed.Manifest)
+	}
+}
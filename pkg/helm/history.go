@@ -0,0 +1,88 @@
+package helm
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// Annotations dev-tool sets on the chart of a release. The chart is stored
+// with every revision, failed ones included, which traces a revision back to
+// the image and commit it deployed without adding chart values.
+const (
+	AnnotationImage  = "io.github.cldmnky.dev-tool.image"
+	AnnotationCommit = "io.github.cldmnky.dev-tool.commit"
+)
+
+// shortCommit is the length of the commits printed in the history
+const shortCommit = 8
+
+// Annotate adds annotations to the metadata of a chart
+func Annotate(ch *chart.Chart, annotations map[string]string) {
+	if ch.Metadata.Annotations == nil {
+		ch.Metadata.Annotations = map[string]string{}
+	}
+	for key, value := range annotations {
+		ch.Metadata.Annotations[key] = value
+	}
+}
+
+// Revision summarizes a revision of a release
+type Revision struct {
+	Version int
+	Updated time.Time
+	Status  string
+	// Chart is name-version of the chart
+	Chart string
+	// Tag is the image.tag value of the revision
+	Tag string
+	// Commit is the git commit deployed, empty when not deployed by dev-tool
+	Commit      string
+	Description string
+}
+
+// Summarize returns the revision summary of a release
+func Summarize(rel *release.Release) Revision {
+	revision := Revision{Version: rel.Version}
+	if rel.Info != nil {
+		revision.Updated = rel.Info.LastDeployed.Time
+		revision.Status = rel.Info.Status.String()
+		revision.Description = rel.Info.Description
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		revision.Chart = fmt.Sprintf("%s-%s", rel.Chart.Metadata.Name, rel.Chart.Metadata.Version)
+		revision.Commit = rel.Chart.Metadata.Annotations[AnnotationCommit]
+	}
+	if image, ok := rel.Config["image"].(map[string]interface{}); ok {
+		if tag, ok := image["tag"]; ok && tag != nil {
+			revision.Tag = fmt.Sprintf("%v", tag)
+		}
+	}
+	return revision
+}
+
+// PrintHistory writes a line per revision of a release
+func PrintHistory(w io.Writer, history []*release.Release) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REVISION\tUPDATED\tSTATUS\tCHART\tIMAGE TAG\tCOMMIT\tDESCRIPTION")
+	for _, rel := range history {
+		r := Summarize(rel)
+		commit := r.Commit
+		if len(commit) > shortCommit {
+			commit = commit[:shortCommit]
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Version, r.Updated.Format(time.RFC3339), r.Status, r.Chart, orNone(r.Tag), orNone(commit), r.Description)
+	}
+	return tw.Flush()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,55 @@
+package helm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	r := testRunner(t)
+	for i, commit := range []string{"1111111111111111", "2222222222222222"} {
+		ch := testChart("0.1.0")
+		Annotate(ch, map[string]string{AnnotationCommit: commit})
+		tag := commit[:3]
+		if _, err := r.Upgrade("app", ch, values(tag), &Options{Install: true}); err != nil {
+			t.Fatalf("deploy %d: %s", i, err)
+		}
+	}
+	if err := r.Rollback("app", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	history, err := r.History("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Revision{
+		{Version: 1, Status: "superseded", Tag: "111", Commit: "1111111111111111"},
+		{Version: 2, Status: "superseded", Tag: "222", Commit: "2222222222222222"},
+		{Version: 3, Status: "deployed", Tag: "111", Commit: "1111111111111111"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("history has %d revisions, want %d", len(history), len(want))
+	}
+	for i, w := range want {
+		got := Summarize(history[i])
+		if got.Version != w.Version || got.Status != w.Status || got.Tag != w.Tag || got.Commit != w.Commit {
+			t.Errorf("revision %d = %+v, want %+v", i+1, got, w)
+		}
+		if got.Chart != "app-0.1.0" {
+			t.Errorf("revision %d chart = %s, want app-0.1.0", i+1, got.Chart)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := PrintHistory(&out, history); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("printed %d lines, want a header and 3 revisions:\n%s", len(lines), out.String())
+	}
+	if fields := strings.Fields(lines[3]); fields[0] != "3" || fields[4] != "111" || fields[5] != "11111111" {
+		t.Errorf("printed %q for revision 3", lines[3])
+	}
+}
@@ -0,0 +1,174 @@
+package helm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/strvals"
+)
+
+// ValueSource is a layer of chart values and where they come from, i.e. a
+// values file, the repo config or --set
+type ValueSource struct {
+	Origin string
+	Values map[string]interface{}
+}
+
+// ReadValuesFile reads a values file
+func ReadValuesFile(path string) (map[string]interface{}, error) {
+	values, err := chartutil.ReadValuesFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read values %s: %s", path, err)
+	}
+	return values.AsMap(), nil
+}
+
+// ReadValues parses values in YAML, like the values files of a chart
+func ReadValues(data []byte) (map[string]interface{}, error) {
+	values, err := chartutil.ReadValues(data)
+	if err != nil {
+		return nil, err
+	}
+	return values.AsMap(), nil
+}
+
+// ParseSet parses key=value pairs as given to helm --set, a.b=c sets the
+// nested key b of a and a=null removes a
+func ParseSet(pairs []string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, pair := range pairs {
+		if err := strvals.ParseInto(pair, values); err != nil {
+			return nil, fmt.Errorf("Could not parse --set %s: %s", pair, err)
+		}
+	}
+	return values, nil
+}
+
+// MergeValues merges the sources in order, values of later sources take
+// precedence. Maps are merged key by key while lists and other values are
+// replaced. A null value is kept in the result so that it also removes the
+// default of the chart when passed to helm. The origin of every key in the
+// result is returned by its dotted path.
+func MergeValues(sources []ValueSource) (map[string]interface{}, map[string]string) {
+	values := map[string]interface{}{}
+	origins := map[string]string{}
+	for _, source := range sources {
+		mergeValues(values, Normalize(source.Values), "", source.Origin, origins)
+	}
+	return values, origins
+}
+
+func mergeValues(dst map[string]interface{}, src map[string]interface{}, prefix string, origin string, origins map[string]string) {
+	for key, value := range src {
+		path := prefix + key
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeValues(dstMap, srcMap, path+".", origin, origins)
+			continue
+		}
+		removeOrigins(origins, path)
+		if srcIsMap {
+			copied := map[string]interface{}{}
+			mergeValues(copied, srcMap, path+".", origin, origins)
+			dst[key] = copied
+			if len(srcMap) == 0 {
+				origins[path] = origin
+			}
+			continue
+		}
+		dst[key] = value
+		if value != nil {
+			origins[path] = origin
+		}
+	}
+}
+
+// removeOrigins forgets the origins of a key and its nested keys
+func removeOrigins(origins map[string]string, path string) {
+	for key := range origins {
+		if key == path || strings.HasPrefix(key, path+".") {
+			delete(origins, key)
+		}
+	}
+}
+
+// Normalize converts the nested maps of values decoded from YAML by other
+// means than chartutil, like the repo config, to map[string]interface{}
+func Normalize(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	return normalize(values).(map[string]interface{})
+}
+
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = normalize(item)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprintf("%v", key)] = normalize(item)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, item := range v {
+			l[i] = normalize(item)
+		}
+		return l
+	}
+	return value
+}
+
+// PrintValues writes every key of the merged values, by its dotted path, with
+// its value and origin. Removed keys are left out.
+func PrintValues(w io.Writer, values map[string]interface{}, origins map[string]string) error {
+	leaves := map[string]interface{}{}
+	flatten(values, "", leaves)
+	keys := []string{}
+	for key := range leaves {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tORIGIN")
+	for _, key := range keys {
+		value, err := json.Marshal(leaves[key])
+		if err != nil {
+			return fmt.Errorf("Could not print value of %s: %s", key, err)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", key, value, origins[key])
+	}
+	return tw.Flush()
+}
+
+// flatten collects the values that are not maps, and empty maps, by their
+// dotted path
+func flatten(values map[string]interface{}, prefix string, leaves map[string]interface{}) {
+	for key, value := range values {
+		path := prefix + key
+		switch v := value.(type) {
+		case nil:
+		case map[string]interface{}:
+			if len(v) == 0 {
+				leaves[path] = v
+				continue
+			}
+			flatten(v, path+".", leaves)
+		default:
+			leaves[path] = v
+		}
+	}
+}
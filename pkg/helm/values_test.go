@@ -0,0 +1,68 @@
+package helm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeValues(t *testing.T) {
+	set, err := ParseSet([]string{"image.tag=fix", "debug=null"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, origins := MergeValues([]ValueSource{
+		{Origin: "values.yaml", Values: map[string]interface{}{
+			"image":     map[string]interface{}{"repository": "app", "tag": "latest"},
+			"resources": map[string]interface{}{"cpu": "100m"},
+			"debug":     true,
+		}},
+		{Origin: "values-test.yaml", Values: map[string]interface{}{
+			"resources": map[interface{}]interface{}{"memory": "128Mi"},
+			"hosts":     []interface{}{"test.example.com"},
+		}},
+		{Origin: "image", Values: map[string]interface{}{
+			"image": map[string]interface{}{"repository": "registry/app", "tag": "abc"},
+		}},
+		{Origin: "--set", Values: set},
+	})
+
+	want := map[string]interface{}{
+		"image":     map[string]interface{}{"repository": "registry/app", "tag": "fix"},
+		"resources": map[string]interface{}{"cpu": "100m", "memory": "128Mi"},
+		"hosts":     []interface{}{"test.example.com"},
+		"debug":     nil,
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %v, want %v", values, want)
+	}
+	wantOrigins := map[string]string{
+		"image.repository": "image",
+		"image.tag":        "--set",
+		"resources.cpu":    "values.yaml",
+		"resources.memory": "values-test.yaml",
+		"hosts":            "values-test.yaml",
+	}
+	if !reflect.DeepEqual(origins, wantOrigins) {
+		t.Errorf("origins = %v, want %v", origins, wantOrigins)
+	}
+}
+
+func TestPrintValues(t *testing.T) {
+	values, origins := MergeValues([]ValueSource{
+		{Origin: "values.yaml", Values: map[string]interface{}{"replicas": 1, "removed": "x"}},
+		{Origin: "--set", Values: map[string]interface{}{"replicas": 2, "removed": nil}},
+	})
+	var out bytes.Buffer
+	if err := PrintValues(&out, values, origins); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("printed %d lines, want a header and replicas:\n%s", len(lines), out.String())
+	}
+	if fields := strings.Fields(lines[1]); !reflect.DeepEqual(fields, []string{"replicas", "2", "--set"}) {
+		t.Errorf("printed %q, want replicas 2 --set", lines[1])
+	}
+}
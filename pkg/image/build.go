@@ -2,45 +2,172 @@ package image
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/cldmnky/dev-tool/pkg/git"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/jsonmessage"
-	"github.com/docker/docker/pkg/term"
+	"github.com/docker/docker/pkg/stringid"
+	digest "github.com/opencontainers/go-digest"
 )
 
-// BuildImage builds a docker image
-func BuildImage(dockerFilePath string, buildContextPath string, tag string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(300)*time.Second)
-	defer cancel()
-	cli, err := client.NewEnvClient()
+// BuildOptions defines how an image is built
+type BuildOptions struct {
+	// Dockerfile is the path to the Dockerfile, relative paths are resolved
+	// from the working directory
+	Dockerfile string
+	// Context is the path to the build context
+	Context   string
+	Tags      []string
+	BuildArgs map[string]*string
+	Target    string
+	Labels    map[string]string
+	NoCache   bool
+	Pull      bool
+	Network   string
+	// Git is used to stamp the OCI standard labels on the image, labels
+	// set explicitly take precedence
+	Git         *git.Info
+	NoOCILabels bool
+	// Reproducible normalizes the build context, file times are set to the
+	// commit time, so the same commit always sends the same context
+	Reproducible bool
+	// Output receives the build progress, defaults to stderr
+	Output io.Writer
+}
+
+// BuildImage builds a docker image, when ctx is cancelled the build is
+// aborted on the daemon as well
+func BuildImage(ctx context.Context, cli *client.Client, opts *BuildOptions) (*Result, error) {
+	start := time.Now()
+	dockerFile, err := relativeDockerfile(opts.Context, opts.Dockerfile)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	created := start
+	if opts.Reproducible {
+		created = sourceTime(opts.Git)
+	}
+	labels := imageLabels(opts, created)
 	buildOpts := types.ImageBuildOptions{
-		Dockerfile: dockerFilePath,
-		Tags:       []string{tag},
+		Dockerfile:  dockerFile,
+		Tags:        opts.Tags,
+		BuildArgs:   opts.BuildArgs,
+		Target:      opts.Target,
+		Labels:      labels,
+		NoCache:     opts.NoCache,
+		PullParent:  opts.Pull,
+		NetworkMode: opts.Network,
+		Remove:      true,
+		BuildID:     stringid.GenerateRandomID(),
 	}
 
-	buildCtx, _ := archive.TarWithOptions(buildContextPath, &archive.TarOptions{})
+	excludes, err := readDockerignore(opts.Context, dockerFile)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := summarizeContext(opts.Context, excludes)
+	if err != nil {
+		return nil, err
+	}
+	out := opts.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	summary.print(out, 5)
+
+	var buildCtx io.ReadCloser
+	var ctxDigest digest.Digest
+	if opts.Reproducible {
+		buildCtx, ctxDigest, err = reproducibleContext(opts.Context, excludes, created)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(out, "Context digest: %s\n", ctxDigest)
+	} else {
+		buildCtx, err = archive.TarWithOptions(opts.Context, &archive.TarOptions{
+			ExcludePatterns: excludes,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer buildCtx.Close()
 
 	resp, err := cli.ImageBuild(ctx, buildCtx, buildOpts)
 	if err != nil {
-		return err
+		return nil, cancelBuild(ctx, cli, buildOpts.BuildID, err)
 	}
 	defer resp.Body.Close()
 
-	termFd, isTerm := term.GetFdInfo(os.Stderr)
-	jsonmessage.DisplayJSONMessagesStream(resp.Body, os.Stderr, termFd, isTerm, nil)
-
-	imagePushOpts := types.ImagePushOptions{} // TODO add auth creds
-	pushResp, err := cli.ImagePush(ctx, tag, imagePushOpts)
+	buildResult := types.BuildResult{}
+	err = displayStream(resp.Body, out, func(msg jsonmessage.JSONMessage) {
+		json.Unmarshal(*msg.Aux, &buildResult)
+	})
 	if err != nil {
+		return nil, cancelBuild(ctx, cli, buildOpts.BuildID, err)
+	}
+	if buildResult.ID == "" {
+		return nil, fmt.Errorf("Build did not report an image id")
+	}
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, buildResult.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		ID:            buildResult.ID,
+		Tags:          opts.Tags,
+		Size:          inspect.Size,
+		Duration:      time.Since(start).Seconds(),
+		ContextDigest: ctxDigest.String(),
+	}
+	if opts.Git != nil {
+		result.Revision = opts.Git.Commit
+	}
+	return result, nil
+}
+
+// cancelBuild asks the daemon to abort the build when ctx is done. The
+// classic builder stops when the connection is closed, the cancel request
+// is needed for BuildKit.
+func cancelBuild(ctx context.Context, cli *client.Client, buildID string, err error) error {
+	if ctx.Err() == nil {
 		return err
 	}
-	defer pushResp.Close()
-	return nil
+	cancelCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cli.BuildCancel(cancelCtx, buildID)
+	return contextError(ctx, "Build", err)
+}
+
+// relativeDockerfile returns the Dockerfile path relative to the build context
+func relativeDockerfile(contextPath string, dockerFile string) (string, error) {
+	if dockerFile == "" {
+		return "Dockerfile", nil
+	}
+	absContext, err := filepath.Abs(contextPath)
+	if err != nil {
+		return "", err
+	}
+	absDockerfile, err := filepath.Abs(dockerFile)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absContext, absDockerfile)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("Dockerfile %s is outside the build context %s", dockerFile, contextPath)
+	}
+	return filepath.ToSlash(rel), nil
 }
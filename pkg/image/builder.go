@@ -0,0 +1,80 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/docker/docker/client"
+)
+
+// Builder backends selectable with --builder
+const (
+	DockerBuilder = "docker"
+	OCIBuilder    = "oci"
+)
+
+// Builder builds images and pushes them to a registry
+type Builder interface {
+	// Build builds the image and tags it with opts.Tags
+	Build(ctx context.Context, opts *BuildOptions) (*Result, error)
+	// Push pushes the image tagged ref and returns the manifest digest
+	Push(ctx context.Context, ref string, out io.Writer) (string, error)
+	// Lookup returns the locally built image tagged ref, found is false
+	// when there is none
+	Lookup(ctx context.Context, ref string) (*Result, bool, error)
+	// Tag adds the target tag to the local image tagged source
+	Tag(ctx context.Context, source string, target string) error
+	// Layers calls scan with every uncompressed layer of the local image
+	// tagged ref, from the base layer up
+	Layers(ctx context.Context, ref string, scan func(layer io.Reader) error) error
+}
+
+// NewBuilder returns the builder backend by name. The docker builder talks to
+// the engine, nil for the docker environment. The oci builder writes to
+// output, an OCI layout directory or a .tar file, by default a layout per
+// repository in the user cache directory.
+func NewBuilder(name string, output string, engine *config.Engine, registries []config.Registry) (Builder, error) {
+	switch name {
+	case DockerBuilder, "":
+		cli, err := NewEngineClient(engine)
+		if err != nil {
+			return nil, err
+		}
+		return &dockerBuilder{cli: cli, registries: registries}, nil
+	case OCIBuilder:
+		return &ociBuilder{output: output, registries: registries}, nil
+	}
+	return nil, fmt.Errorf("Unknown builder: %s", name)
+}
+
+// dockerBuilder builds and pushes with the docker daemon
+type dockerBuilder struct {
+	cli        *client.Client
+	registries []config.Registry
+}
+
+func (b *dockerBuilder) Build(ctx context.Context, opts *BuildOptions) (*Result, error) {
+	return BuildImage(ctx, b.cli, opts)
+}
+
+func (b *dockerBuilder) Push(ctx context.Context, ref string, out io.Writer) (string, error) {
+	return PushImage(ctx, b.cli, ref, b.registries, out)
+}
+
+func (b *dockerBuilder) Lookup(ctx context.Context, ref string) (*Result, bool, error) {
+	inspect, found, err := LocalImage(ctx, b.cli, ref)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return &Result{ID: inspect.ID, Size: inspect.Size}, true, nil
+}
+
+func (b *dockerBuilder) Tag(ctx context.Context, source string, target string) error {
+	return TagImage(ctx, b.cli, source, target)
+}
+
+func (b *dockerBuilder) Layers(ctx context.Context, ref string, scan func(layer io.Reader) error) error {
+	return ImageLayers(ctx, b.cli, ref, scan)
+}
@@ -0,0 +1,253 @@
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cldmnky/dev-tool/pkg/git"
+	"github.com/docker/docker/builder/dockerignore"
+	"github.com/docker/docker/pkg/fileutils"
+	units "github.com/docker/go-units"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// contextSummary holds size information about a build context
+type contextSummary struct {
+	Size  int64
+	Files int
+	// Paths holds the included size per top level path
+	Paths map[string]int64
+}
+
+// readDockerignore returns the exclude patterns from the .dockerignore in the
+// build context. The Dockerfile and .dockerignore are always sent to the
+// daemon, the same way the docker cli does.
+func readDockerignore(contextPath string, dockerFile string) ([]string, error) {
+	excludes := []string{}
+	f, err := os.Open(filepath.Join(contextPath, ".dockerignore"))
+	switch {
+	case os.IsNotExist(err):
+		return excludes, nil
+	case err != nil:
+		return nil, err
+	}
+	defer f.Close()
+
+	excludes, err = dockerignore.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse .dockerignore: %s", err)
+	}
+	for _, keep := range []string{".dockerignore", dockerFile} {
+		if matched, _ := fileutils.Matches(keep, excludes); matched {
+			excludes = append(excludes, "!"+keep)
+		}
+	}
+	return excludes, nil
+}
+
+// summarizeContext walks the build context and sums up the files that are
+// not excluded
+func summarizeContext(contextPath string, excludes []string) (*contextSummary, error) {
+	pm, err := fileutils.NewPatternMatcher(excludes)
+	if err != nil {
+		return nil, err
+	}
+	summary := &contextSummary{
+		Paths: map[string]int64{},
+	}
+	err = filepath.Walk(contextPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(contextPath, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		skip, err := pm.Matches(rel)
+		if err != nil {
+			return err
+		}
+		if skip {
+			// a directory can only be skipped entirely when no exception
+			// pattern could include something below it
+			if info.IsDir() && !pm.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		top := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+		summary.Size += info.Size()
+		summary.Files++
+		summary.Paths[top] += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// print writes the context size and the n largest paths
+func (s *contextSummary) print(w io.Writer, n int) {
+	fmt.Fprintf(w, "Sending build context: %s in %d files\n", units.HumanSize(float64(s.Size)), s.Files)
+	paths := make([]string, 0, len(s.Paths))
+	for path := range s.Paths {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return s.Paths[paths[i]] > s.Paths[paths[j]]
+	})
+	if len(paths) > n {
+		paths = paths[:n]
+	}
+	for _, path := range paths {
+		fmt.Fprintf(w, "  %10s  %s\n", units.HumanSize(float64(s.Paths[path])), path)
+	}
+}
+
+// writeContext writes the build context as a tar archive with normalized
+// metadata: entries in lexical order, modification times set to mtime and
+// owned by root without extended attributes, so the same files always give
+// the same archive
+func writeContext(w io.Writer, contextPath string, excludes []string, mtime time.Time) error {
+	pm, err := fileutils.NewPatternMatcher(excludes)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	err = filepath.Walk(contextPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(contextPath, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		skip, err := pm.Matches(rel)
+		if err != nil {
+			return err
+		}
+		if skip {
+			if info.IsDir() && !pm.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		normalizeHeader(hdr, mtime)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// normalizeHeader strips the metadata of a tar entry that differs between
+// checkouts of the same files. Like git only the executable bit of a file is
+// kept, so the umask does not change the entry.
+func normalizeHeader(hdr *tar.Header, mtime time.Time) {
+	switch {
+	case hdr.Typeflag == tar.TypeSymlink:
+		hdr.Mode = 0777
+	case hdr.Typeflag == tar.TypeDir || hdr.Mode&0111 != 0:
+		hdr.Mode = 0755
+	default:
+		hdr.Mode = 0644
+	}
+	hdr.ModTime = mtime
+	hdr.AccessTime = time.Time{}
+	hdr.ChangeTime = time.Time{}
+	hdr.Uid = 0
+	hdr.Gid = 0
+	hdr.Uname = ""
+	hdr.Gname = ""
+	hdr.Xattrs = nil
+	hdr.PAXRecords = nil
+	hdr.Format = tar.FormatPAX
+}
+
+// reproducibleContext writes the normalized build context to a temporary
+// file and returns it with the digest of its content, the file is removed
+// when closed
+func reproducibleContext(contextPath string, excludes []string, mtime time.Time) (io.ReadCloser, digest.Digest, error) {
+	f, err := ioutil.TempFile("", "dev-tool-context-")
+	if err != nil {
+		return nil, "", err
+	}
+	context := &tempFile{f}
+	digester := digest.Canonical.Digester()
+	if err := writeContext(io.MultiWriter(f, digester.Hash()), contextPath, excludes, mtime); err != nil {
+		context.Close()
+		return nil, "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		context.Close()
+		return nil, "", err
+	}
+	return context, digester.Digest(), nil
+}
+
+// contextDigest returns the digest of the normalized build context
+func contextDigest(contextPath string, excludes []string, mtime time.Time) (digest.Digest, error) {
+	digester := digest.Canonical.Digester()
+	if err := writeContext(digester.Hash(), contextPath, excludes, mtime); err != nil {
+		return "", err
+	}
+	return digester.Digest(), nil
+}
+
+// sourceTime returns the time reproducible builds stamp on files, the commit
+// time or the unix epoch without git metadata
+func sourceTime(info *git.Info) time.Time {
+	if info == nil {
+		return time.Unix(0, 0).UTC()
+	}
+	return info.CommitTime.UTC()
+}
+
+// tempFile is a temporary file that is removed when closed
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
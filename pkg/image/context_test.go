@@ -0,0 +1,44 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// modeContext writes a build context with a file, a script and a directory
+// in the given modes and returns its digest
+func modeContext(t *testing.T, file os.FileMode, script os.FileMode, dir os.FileMode) string {
+	t.Helper()
+	contextDir := tempDir(t)
+	writeFiles(t, contextDir, map[string]string{
+		"app.yaml":        "app",
+		"run.sh":          "#!/bin/sh",
+		"conf/conf.yaml":  "conf",
+		"conf/.gitignore": "",
+	})
+	for name, mode := range map[string]os.FileMode{"app.yaml": file, "run.sh": script, "conf": dir} {
+		if err := os.Chmod(filepath.Join(contextDir, name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, err := contextDigest(contextDir, nil, time.Unix(1600000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.String()
+}
+
+func TestContextDigestModes(t *testing.T) {
+	want := modeContext(t, 0644, 0755, 0755)
+	if got := modeContext(t, 0664, 0775, 0775); got != want {
+		t.Errorf("group writable context digest %s, want %s", got, want)
+	}
+	if got := modeContext(t, 0600, 0700, 0700); got != want {
+		t.Errorf("private context digest %s, want %s", got, want)
+	}
+	if got := modeContext(t, 0755, 0755, 0755); got == want {
+		t.Error("making a file executable did not change the context digest")
+	}
+}
@@ -0,0 +1,185 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/docker/docker/client"
+)
+
+// sshDaemonHost is the placeholder host of clients that reach the daemon
+// through ssh, the connection is made by the dialer
+const sshDaemonHost = "http://docker.example.com"
+
+// NewEngineClient returns a client for the container engine, without an
+// engine the DOCKER_HOST, DOCKER_CERT_PATH and DOCKER_API_VERSION
+// environment is used like the docker cli does. The API version is
+// negotiated with the daemon unless it is pinned.
+func NewEngineClient(engine *config.Engine) (*client.Client, error) {
+	if engine == nil {
+		host := os.Getenv("DOCKER_HOST")
+		if !strings.HasPrefix(host, "ssh://") {
+			return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		}
+		engine = &config.Engine{Host: host, APIVersion: os.Getenv("DOCKER_API_VERSION")}
+	}
+
+	host := engine.Host
+	if host == "" && engine.Podman {
+		host = podmanSocket()
+	}
+	opts := []client.Opt{client.WithAPIVersionNegotiation()}
+	switch {
+	case strings.HasPrefix(host, "ssh://"):
+		u, err := url.Parse(host)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid engine host %s: %s", host, err)
+		}
+		opts = append(opts, client.WithHost(sshDaemonHost), client.WithDialContext(sshDialer(u)))
+	case host != "":
+		opts = append(opts, client.WithHost(host))
+	}
+	if engine.CertPath != "" {
+		opts = append(opts, client.WithTLSClientConfig(
+			filepath.Join(engine.CertPath, "ca.pem"),
+			filepath.Join(engine.CertPath, "cert.pem"),
+			filepath.Join(engine.CertPath, "key.pem"),
+		))
+	}
+	if engine.APIVersion != "" {
+		opts = append(opts, client.WithVersion(engine.APIVersion))
+	}
+	return client.NewClientWithOpts(opts...)
+}
+
+// podmanSocket returns the socket of the podman API service, rootless when
+// XDG_RUNTIME_DIR is set
+func podmanSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return fmt.Sprintf("unix://%s/podman/podman.sock", dir)
+	}
+	return "unix:///run/podman/podman.sock"
+}
+
+// sshDialer connects to the daemon of a remote host by running docker
+// system dial-stdio over ssh, the same way the docker cli does
+func sshDialer(u *url.URL) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	args := []string{}
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	args = append(args, "--", u.Hostname(), "docker", "system", "dial-stdio")
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		cmd := exec.Command("ssh", args...)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		conn := &commandConn{
+			cmd:    cmd,
+			stdin:  stdin,
+			stdout: stdout,
+			host:   u.Host,
+		}
+		cmd.Stderr = &conn.stderr
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("Could not run ssh: %s", err)
+		}
+		return conn, nil
+	}
+}
+
+// commandConn is a connection over the stdin and stdout of a command
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr lockedBuffer
+	host   string
+
+	closeOnce sync.Once
+}
+
+func (c *commandConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if err == io.EOF {
+		if stderr := strings.TrimSpace(c.stderr.String()); stderr != "" {
+			return n, fmt.Errorf("ssh %s: %s", c.host, stderr)
+		}
+	}
+	return n, err
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr {
+	return commandAddr("dev-tool")
+}
+
+func (c *commandConn) RemoteAddr() net.Addr {
+	return commandAddr(c.host)
+}
+
+// deadlines are not supported, requests are bound by their context
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// lockedBuffer collects the stderr of a command, exec writes it from its own
+// goroutine while the connection is read
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// commandAddr is the address of a commandConn
+type commandAddr string
+
+func (a commandAddr) Network() string {
+	return "ssh"
+}
+
+func (a commandAddr) String() string {
+	return string(a)
+}
@@ -0,0 +1,26 @@
+package image
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// LocalImage inspects an image in the local daemon, found is false when the
+// daemon does not have it
+func LocalImage(ctx context.Context, cli *client.Client, ref string) (*types.ImageInspect, bool, error) {
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return &inspect, true, nil
+}
+
+// TagImage adds the target tag to a local image
+func TagImage(ctx context.Context, cli *client.Client, source string, target string) error {
+	return cli.ImageTag(ctx, source, target)
+}
@@ -0,0 +1,228 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cldmnky/dev-tool/pkg/dockerfile"
+	"github.com/docker/distribution/reference"
+)
+
+// Job is an image in a build graph
+type Job struct {
+	Name string
+	// Image is the reference the job builds, FROM lines of other jobs are
+	// matched against its repository name
+	Image      string
+	Dockerfile string
+	// DependsOn holds the names of the jobs this job builds FROM
+	DependsOn []string
+	// BaseArgs maps the build args used as the tag of a FROM line on another
+	// job, like base:${BASE_TAG}, to that job. The args are set to the tag
+	// the dependency built, a FROM line with a fixed tag builds on whatever
+	// image has that tag.
+	BaseArgs map[string]string
+}
+
+// tagArgPattern matches a tag that is a single build arg
+var tagArgPattern = regexp.MustCompile(`^\$(\{(\w+)\}|(\w+))$`)
+
+// ErrDependencyFailed is returned for jobs that did not run because a job
+// they depend on failed
+var ErrDependencyFailed = fmt.Errorf("dependency failed")
+
+// BaseImages returns the images a Dockerfile builds FROM, references to
+// earlier build stages are left out
+func BaseImages(dockerFile string) ([]string, error) {
+	instructions, err := dockerfile.ParseFile(dockerFile)
+	if err != nil {
+		return nil, err
+	}
+	images := []string{}
+	stages := map[string]bool{}
+	for _, instruction := range instructions {
+		args := instruction.Args
+		if instruction.Cmd != "FROM" || len(args) == 0 {
+			continue
+		}
+		if !stages[strings.ToLower(args[0])] {
+			images = append(images, args[0])
+		}
+		if len(args) == 3 && strings.EqualFold(args[1], "AS") {
+			stages[strings.ToLower(args[2])] = true
+		}
+	}
+	return images, nil
+}
+
+// ResolveDependencies sets DependsOn for every job from the FROM lines of its
+// Dockerfile and fails on dependency cycles
+func ResolveDependencies(jobs []*Job) error {
+	byRepository := map[string]string{}
+	for _, job := range jobs {
+		if name := repositoryName(job.Image); name != "" {
+			byRepository[name] = job.Name
+		}
+	}
+	for _, job := range jobs {
+		bases, err := BaseImages(job.Dockerfile)
+		if err != nil {
+			return fmt.Errorf("%s: %s", job.Name, err)
+		}
+		job.DependsOn = []string{}
+		job.BaseArgs = map[string]string{}
+		for _, base := range bases {
+			dep, ok := byRepository[repositoryName(base)]
+			if !ok || dep == job.Name {
+				continue
+			}
+			if !contains(job.DependsOn, dep) {
+				job.DependsOn = append(job.DependsOn, dep)
+			}
+			if arg := tagArg(base); arg != "" {
+				job.BaseArgs[arg] = dep
+			}
+		}
+	}
+	_, err := order(jobs)
+	return err
+}
+
+// RunGraph runs the jobs with at most parallel jobs at a time, a job starts
+// once all jobs it depends on have succeeded. The error of every job is
+// returned, nil for the jobs that succeeded.
+func RunGraph(ctx context.Context, jobs []*Job, parallel int, run func(context.Context, *Job) error) map[string]error {
+	if parallel < 1 {
+		parallel = 1
+	}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = map[string]error{}
+		done    = map[string]chan struct{}{}
+		slots   = make(chan struct{}, parallel)
+	)
+	for _, job := range jobs {
+		done[job.Name] = make(chan struct{})
+	}
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job *Job) {
+			defer wg.Done()
+			defer close(done[job.Name])
+			err := func() error {
+				for _, dep := range job.DependsOn {
+					select {
+					case <-done[dep]:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+					mu.Lock()
+					depErr := results[dep]
+					mu.Unlock()
+					if depErr != nil {
+						return ErrDependencyFailed
+					}
+				}
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				defer func() { <-slots }()
+				return run(ctx, job)
+			}()
+			mu.Lock()
+			results[job.Name] = err
+			mu.Unlock()
+		}(job)
+	}
+	wg.Wait()
+	return results
+}
+
+// order sorts the jobs so that every job comes after its dependencies
+func order(jobs []*Job) ([]*Job, error) {
+	byName := map[string]*Job{}
+	for _, job := range jobs {
+		byName[job.Name] = job
+	}
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	sorted := []*Job{}
+	var visit func(job *Job, path []string) error
+	visit = func(job *Job, path []string) error {
+		switch state[job.Name] {
+		case visiting:
+			return fmt.Errorf("Dependency cycle: %s", strings.Join(append(path, job.Name), " -> "))
+		case visited:
+			return nil
+		}
+		state[job.Name] = visiting
+		for _, dep := range job.DependsOn {
+			depJob, ok := byName[dep]
+			if !ok {
+				return fmt.Errorf("%s depends on unknown image %s", job.Name, dep)
+			}
+			if err := visit(depJob, append(path, job.Name)); err != nil {
+				return err
+			}
+		}
+		state[job.Name] = visited
+		sorted = append(sorted, job)
+		return nil
+	}
+	names := make([]string, 0, len(jobs))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := visit(byName[name], nil); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// repositoryName returns the normalized repository of an image reference.
+// Tags using build args, like base:${VERSION}, are dropped before parsing.
+func repositoryName(image string) string {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") && strings.Contains(image[i:], "$") {
+		image = image[:i]
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return ""
+	}
+	return named.Name()
+}
+
+// tagArg returns the build arg an image reference uses as its tag
+func tagArg(image string) string {
+	i := strings.LastIndex(image, ":")
+	if i < 0 || i < strings.LastIndex(image, "/") {
+		return ""
+	}
+	m := tagArgPattern.FindStringSubmatch(image[i+1:])
+	if m == nil {
+		return ""
+	}
+	return m[2] + m[3]
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
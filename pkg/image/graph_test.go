@@ -0,0 +1,48 @@
+package image
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveDependencies(t *testing.T) {
+	dir := tempDir(t)
+	writeFiles(t, dir, map[string]string{
+		"base/Dockerfile":  "FROM alpine:3.12\n",
+		"tools/Dockerfile": "FROM registry.example.com/base:latest\n",
+		"app/Dockerfile":   "ARG BASE_TAG=latest\nFROM registry.example.com/base:${BASE_TAG} AS build\nFROM registry.example.com/tools:$TOOLS\nCOPY --from=build /app /app\n",
+	})
+	jobs := []*Job{}
+	for _, name := range []string{"base", "tools", "app"} {
+		jobs = append(jobs, &Job{
+			Name:       name,
+			Image:      "registry.example.com/" + name + ":abc",
+			Dockerfile: filepath.Join(dir, name, "Dockerfile"),
+		})
+	}
+	if err := ResolveDependencies(jobs); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		dependsOn []string
+		baseArgs  map[string]string
+	}{
+		{[]string{}, map[string]string{}},
+		{[]string{"base"}, map[string]string{}},
+		{[]string{"base", "tools"}, map[string]string{"BASE_TAG": "base", "TOOLS": "tools"}},
+	}
+	for i, job := range jobs {
+		if !reflect.DeepEqual(job.DependsOn, want[i].dependsOn) {
+			t.Errorf("%s depends on %v, want %v", job.Name, job.DependsOn, want[i].dependsOn)
+		}
+		if !reflect.DeepEqual(job.BaseArgs, want[i].baseArgs) {
+			t.Errorf("%s base args %v, want %v", job.Name, job.BaseArgs, want[i].baseArgs)
+		}
+	}
+
+	writeFiles(t, dir, map[string]string{"base/Dockerfile": "FROM registry.example.com/app\n"})
+	if err := ResolveDependencies(jobs); err == nil {
+		t.Error("resolved a dependency cycle")
+	}
+}
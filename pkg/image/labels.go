@@ -0,0 +1,96 @@
+package image
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cldmnky/dev-tool/pkg/git"
+)
+
+// OCI annotation keys, see
+// https://github.com/opencontainers/image-spec/blob/master/annotations.md
+const (
+	LabelCreated  = "org.opencontainers.image.created"
+	LabelAuthors  = "org.opencontainers.image.authors"
+	LabelSource   = "org.opencontainers.image.source"
+	LabelVersion  = "org.opencontainers.image.version"
+	LabelRevision = "org.opencontainers.image.revision"
+	LabelRefName  = "org.opencontainers.image.ref.name"
+)
+
+// LabelBuiltBy is stamped on every image dev-tool builds, image prune only
+// removes images with this label
+const LabelBuiltBy = "io.github.cldmnky.dev-tool.built-by"
+
+// builtByValue is the value of LabelBuiltBy
+const builtByValue = "dev-tool"
+
+// OCILabels returns the OCI standard labels for the git metadata
+func OCILabels(info *git.Info, created time.Time) map[string]string {
+	labels := map[string]string{
+		LabelCreated:  created.UTC().Format(time.RFC3339),
+		LabelRevision: info.Commit,
+		LabelAuthors:  info.Author,
+		LabelVersion:  info.ShortCommit(),
+	}
+	switch {
+	case info.Tag != "":
+		labels[LabelVersion] = info.Tag
+	case info.Describe != "":
+		labels[LabelVersion] = info.Describe
+	}
+	if info.Dirty {
+		labels[LabelVersion] += dirtySuffix
+	}
+	switch {
+	case info.Branch != "":
+		labels[LabelRefName] = info.Branch
+	case info.Tag != "":
+		labels[LabelRefName] = info.Tag
+	}
+	if source := sourceURL(info.RemoteURL); source != "" {
+		labels[LabelSource] = source
+	}
+	return labels
+}
+
+// imageLabels returns the labels of a build, the OCI labels and the built by
+// label are overridden by the labels set explicitly
+func imageLabels(opts *BuildOptions, created time.Time) map[string]string {
+	labels := map[string]string{}
+	if opts.Git != nil && !opts.NoOCILabels {
+		labels = OCILabels(opts.Git, created)
+	}
+	labels[LabelBuiltBy] = builtByValue
+	for key, value := range opts.Labels {
+		labels[key] = value
+	}
+	return labels
+}
+
+// sourceURL turns a git remote into a browsable https url and strips any
+// credentials, i.e. git@github.com:org/repo.git becomes
+// https://github.com/org/repo
+func sourceURL(remote string) string {
+	if remote == "" {
+		return ""
+	}
+	remote = strings.TrimSuffix(remote, ".git")
+	if !strings.Contains(remote, "://") {
+		// scp like syntax, user@host:path
+		if i := strings.Index(remote, "@"); i >= 0 {
+			remote = remote[i+1:]
+		}
+		return "https://" + strings.Replace(remote, ":", "/", 1)
+	}
+	u, err := url.Parse(remote)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	if u.Scheme != "http" {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
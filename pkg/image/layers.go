@@ -0,0 +1,114 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+)
+
+// saveManifest is an entry of manifest.json in the output of docker save
+type saveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// ImageLayers calls scan with every uncompressed layer of a local image,
+// from the base layer up. The image is saved from the daemon to a temporary
+// directory first, docker save writes manifest.json after the layers.
+func ImageLayers(ctx context.Context, cli *client.Client, ref string, scan func(layer io.Reader) error) error {
+	dir, err := ioutil.TempDir("", "dev-tool-save")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	rc, err := cli.ImageSave(ctx, []string{ref})
+	if err != nil {
+		return fmt.Errorf("Could not save image %s: %s", ref, err)
+	}
+	defer rc.Close()
+	if err := extractSave(rc, dir); err != nil {
+		return contextError(ctx, "Save", err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return fmt.Errorf("Could not read the manifest of %s: %s", ref, err)
+	}
+	manifests := []saveManifest{}
+	if err := json.Unmarshal(content, &manifests); err != nil {
+		return fmt.Errorf("Could not parse the manifest of %s: %s", ref, err)
+	}
+	if len(manifests) != 1 {
+		return fmt.Errorf("Expected one image in the save of %s, got %d", ref, len(manifests))
+	}
+	for _, layer := range manifests[0].Layers {
+		if err := scanFile(filepath.Join(dir, filepath.FromSlash(path.Clean("/"+layer))), scan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractSave writes the files and links of a docker save archive to dir
+func extractSave(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeSymlink {
+			continue
+		}
+		name := path.Clean("/" + hdr.Name)
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeSymlink {
+			// layers shared between images are linked, the link has to
+			// stay inside the archive
+			if path.IsAbs(hdr.Linkname) || strings.HasPrefix(path.Join(path.Dir(name)[1:], hdr.Linkname), "..") {
+				return fmt.Errorf("Invalid link in image archive: %s", hdr.Name)
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+			continue
+		}
+		f, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func scanFile(name string, scan func(layer io.Reader) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return scan(f)
+}
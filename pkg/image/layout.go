@@ -0,0 +1,264 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/docker/distribution/reference"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const indexFile = "index.json"
+
+// Layout is an OCI image layout directory
+type Layout struct {
+	Path string
+}
+
+// OpenLayout opens the OCI image layout in dir, an empty layout is created
+// when the directory does not hold one yet
+func OpenLayout(dir string) (*Layout, error) {
+	l := &Layout{Path: dir}
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", string(digest.Canonical)), 0755); err != nil {
+		return nil, err
+	}
+	layoutFile := filepath.Join(dir, ocispec.ImageLayoutFile)
+	if _, err := os.Stat(layoutFile); err == nil {
+		return l, nil
+	}
+	content, err := json.Marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(layoutFile, content, 0644); err != nil {
+		return nil, err
+	}
+	if err := l.writeIndex(&ocispec.Index{Versioned: specs.Versioned{SchemaVersion: 2}}); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// DefaultLayoutPath returns the layout directory for the repository of ref
+// in the user cache directory
+func DefaultLayoutPath(ref string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", err
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache, "dev-tool", "oci", filepath.FromSlash(named.Name())), nil
+}
+
+// BlobPath returns the path of the blob with digest d
+func (l *Layout) BlobPath(d digest.Digest) string {
+	return filepath.Join(l.Path, "blobs", string(d.Algorithm()), d.Encoded())
+}
+
+// HasBlob returns whether the layout holds the blob with digest d
+func (l *Layout) HasBlob(d digest.Digest) bool {
+	_, err := os.Stat(l.BlobPath(d))
+	return err == nil
+}
+
+// ReadBlob returns the content of the blob with digest d
+func (l *Layout) ReadBlob(d digest.Digest) ([]byte, error) {
+	return ioutil.ReadFile(l.BlobPath(d))
+}
+
+// WriteBlob stores content and returns its descriptor
+func (l *Layout) WriteBlob(mediaType string, content []byte) (ocispec.Descriptor, error) {
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(content),
+		Size:      int64(len(content)),
+	}
+	if l.HasBlob(desc.Digest) {
+		return desc, nil
+	}
+	return desc, ioutil.WriteFile(l.BlobPath(desc.Digest), content, 0644)
+}
+
+// CopyBlob stores the content read from r, which has to match the expected
+// digest, and returns its size
+func (l *Layout) CopyBlob(expected digest.Digest, r io.Reader) (int64, error) {
+	f, err := ioutil.TempFile(l.Path, "blob-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	verifier := expected.Verifier()
+	size, err := io.Copy(io.MultiWriter(f, verifier), r)
+	if err != nil {
+		return 0, err
+	}
+	if !verifier.Verified() {
+		return 0, fmt.Errorf("Digest mismatch for blob %s", expected)
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return size, os.Rename(f.Name(), l.BlobPath(expected))
+}
+
+// Index returns the index of the layout
+func (l *Layout) Index() (*ocispec.Index, error) {
+	content, err := ioutil.ReadFile(filepath.Join(l.Path, indexFile))
+	if err != nil {
+		return nil, err
+	}
+	index := &ocispec.Index{}
+	if err := json.Unmarshal(content, index); err != nil {
+		return nil, fmt.Errorf("Could not parse %s: %s", indexFile, err)
+	}
+	return index, nil
+}
+
+// Tag adds the manifest to the index under the reference name ref, an
+// existing entry with the same name is replaced
+func (l *Layout) Tag(desc ocispec.Descriptor, ref string) error {
+	index, err := l.Index()
+	if err != nil {
+		return err
+	}
+	manifests := []ocispec.Descriptor{}
+	for _, m := range index.Manifests {
+		if m.Annotations[ocispec.AnnotationRefName] != ref {
+			manifests = append(manifests, m)
+		}
+	}
+	desc.Annotations = map[string]string{ocispec.AnnotationRefName: ref}
+	index.Manifests = append(manifests, desc)
+	return l.writeIndex(index)
+}
+
+// Resolve returns the descriptor of the manifest tagged ref
+func (l *Layout) Resolve(ref string) (ocispec.Descriptor, bool, error) {
+	index, err := l.Index()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ocispec.Descriptor{}, false, nil
+		}
+		return ocispec.Descriptor{}, false, err
+	}
+	for _, m := range index.Manifests {
+		if m.Annotations[ocispec.AnnotationRefName] == ref {
+			return m, true, nil
+		}
+	}
+	return ocispec.Descriptor{}, false, nil
+}
+
+// WriteTar writes the images tagged refs as an OCI layout tar archive
+func (l *Layout) WriteTar(w io.Writer, refs []string) error {
+	index := &ocispec.Index{Versioned: specs.Versioned{SchemaVersion: 2}}
+	blobs := []digest.Digest{}
+	seen := map[digest.Digest]bool{}
+	for _, ref := range refs {
+		desc, found, err := l.Resolve(ref)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("Image %s not found in %s", ref, l.Path)
+		}
+		index.Manifests = append(index.Manifests, desc)
+		manifest, err := l.Manifest(desc.Digest)
+		if err != nil {
+			return err
+		}
+		for _, d := range append([]digest.Digest{desc.Digest, manifest.Config.Digest}, layerDigests(manifest)...) {
+			if !seen[d] {
+				seen[d] = true
+				blobs = append(blobs, d)
+			}
+		}
+	}
+
+	tw := tar.NewWriter(w)
+	layoutContent, err := json.Marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+	if err != nil {
+		return err
+	}
+	indexContent, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, ocispec.ImageLayoutFile, int64(len(layoutContent)), bytes.NewReader(layoutContent)); err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, indexFile, int64(len(indexContent)), bytes.NewReader(indexContent)); err != nil {
+		return err
+	}
+	for _, d := range blobs {
+		f, err := os.Open(l.BlobPath(d))
+		if err != nil {
+			return err
+		}
+		info, err := f.Stat()
+		if err == nil {
+			err = writeTarFile(tw, path.Join("blobs", string(d.Algorithm()), d.Encoded()), info.Size(), f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// Manifest reads the image manifest with digest d
+func (l *Layout) Manifest(d digest.Digest) (*ocispec.Manifest, error) {
+	content, err := l.ReadBlob(d)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &ocispec.Manifest{}
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, fmt.Errorf("Could not parse manifest %s: %s", d, err)
+	}
+	return manifest, nil
+}
+
+func (l *Layout) writeIndex(index *ocispec.Index) error {
+	content, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(l.Path, indexFile), content, 0644)
+}
+
+func writeTarFile(tw *tar.Writer, name string, size int64, content io.Reader) error {
+	hdr := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, content)
+	return err
+}
+
+func layerDigests(manifest *ocispec.Manifest) []digest.Digest {
+	digests := []digest.Digest{}
+	for _, layer := range manifest.Layers {
+		digests = append(digests, layer.Digest)
+	}
+	return digests
+}
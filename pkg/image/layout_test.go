@@ -0,0 +1,169 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// tempDir returns a directory removed when the test ends
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "dev-tool-image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// extractTar unpacks a tar archive of regular files into dir
+func extractTar(t *testing.T, r io.Reader, dir string) {
+	t.Helper()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(target, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeImage writes a manifest with a config and a layer to the layout
+func writeImage(t *testing.T, l *Layout, layer []byte) ocispec.Descriptor {
+	t.Helper()
+	layerDesc, err := l.WriteBlob(ocispec.MediaTypeImageLayer, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := json.Marshal(ocispec.Image{OS: "linux"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configDesc, err := l.WriteBlob(ocispec.MediaTypeImageConfig, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    configDesc,
+		Layers:    []ocispec.Descriptor{layerDesc},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := l.WriteBlob(ocispec.MediaTypeImageManifest, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return desc
+}
+
+func TestLayoutRoundTrip(t *testing.T) {
+	l, err := OpenLayout(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := writeImage(t, l, []byte("first"))
+	second := writeImage(t, l, []byte("second"))
+	other := writeImage(t, l, []byte("other"))
+	for ref, desc := range map[string]ocispec.Descriptor{
+		"registry/app:v1":    first,
+		"registry/app:other": other,
+	} {
+		if err := l.Tag(desc, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// tagging again moves the tag
+	if err := l.Tag(second, "registry/app:v1"); err != nil {
+		t.Fatal(err)
+	}
+	index, err := l.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 2 {
+		t.Errorf("index has %d manifests, want 2", len(index.Manifests))
+	}
+	if _, found, err := l.Resolve("registry/app:missing"); err != nil || found {
+		t.Errorf("resolved a missing tag: %v %v", found, err)
+	}
+
+	var archive bytes.Buffer
+	if err := l.WriteTar(&archive, []string{"registry/app:v1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.WriteTar(ioutil.Discard, []string{"registry/app:missing"}); err == nil {
+		t.Error("exported a missing tag")
+	}
+
+	dir := tempDir(t)
+	extractTar(t, &archive, dir)
+	exported, err := OpenLayout(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, found, err := exported.Resolve("registry/app:v1")
+	if err != nil || !found {
+		t.Fatalf("tag not exported: %v %v", found, err)
+	}
+	if desc.Digest != second.Digest {
+		t.Errorf("exported %s, want %s", desc.Digest, second.Digest)
+	}
+	if _, found, _ := exported.Resolve("registry/app:other"); found {
+		t.Error("exported a tag that was not asked for")
+	}
+	if exported.HasBlob(first.Digest) || exported.HasBlob(other.Digest) {
+		t.Error("exported blobs of other images")
+	}
+	manifest, err := exported.Manifest(desc.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, blob := range append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...) {
+		content, err := exported.ReadBlob(blob.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !verify(blob, content) {
+			t.Errorf("blob %s does not match its descriptor", blob.Digest)
+		}
+	}
+	layer, err := exported.ReadBlob(manifest.Layers[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(layer) != "second" {
+		t.Errorf("layer = %q, want second", layer)
+	}
+}
+
+// verify checks the size and digest of content
+func verify(desc ocispec.Descriptor, content []byte) bool {
+	verifier := desc.Digest.Verifier()
+	verifier.Write(content)
+	return int64(len(content)) == desc.Size && verifier.Verified()
+}
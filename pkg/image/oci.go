@@ -0,0 +1,931 @@
+package image
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/cldmnky/dev-tool/pkg/dockerfile"
+	"github.com/cldmnky/dev-tool/pkg/registry"
+	"github.com/docker/docker/pkg/fileutils"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const dockerLayerMediaType = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+
+// ociBuilder builds images of simple Dockerfiles without a daemon, the base
+// image is pulled from its registry, every COPY and a WORKDIR that creates a
+// directory add a layer. Images are kept in an OCI layout and pushed from
+// there.
+type ociBuilder struct {
+	output     string
+	registries []config.Registry
+}
+
+// ociBuild is the state of an image being assembled
+type ociBuild struct {
+	opts    *BuildOptions
+	layout  *Layout
+	matcher *fileutils.PatternMatcher
+	out     io.Writer
+
+	// mtime is set on the directories COPY creates, and on all files of
+	// reproducible builds, created is stamped on the image. Both are the
+	// build start or, for reproducible builds, the commit time.
+	mtime   time.Time
+	created time.Time
+	// existing are the paths in the layers so far, see existingPaths
+	existing map[string]bool
+
+	image  ocispec.Image
+	layers []ocispec.Descriptor
+	// metaArgs are declared before FROM, args in the stage. Like docker a
+	// stage only sees the meta args it declares again.
+	metaArgs map[string]string
+	args     map[string]string
+	from     bool
+	cmdSet   bool
+}
+
+func (b *ociBuilder) Build(ctx context.Context, opts *BuildOptions) (*Result, error) {
+	start := time.Now()
+	if len(opts.Tags) == 0 {
+		return nil, fmt.Errorf("No tags to build")
+	}
+	if opts.Target != "" {
+		return nil, fmt.Errorf("Build targets are not supported by the oci builder")
+	}
+	out := opts.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	dockerFile, err := relativeDockerfile(opts.Context, opts.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	instructions, err := dockerfile.ParseFile(filepath.Join(opts.Context, dockerFile))
+	if err != nil {
+		return nil, err
+	}
+	excludes, err := readDockerignore(opts.Context, dockerFile)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := summarizeContext(opts.Context, excludes)
+	if err != nil {
+		return nil, err
+	}
+	summary.print(out, 5)
+	matcher, err := fileutils.NewPatternMatcher(excludes)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := b.layout(opts.Tags[0])
+	if err != nil {
+		return nil, err
+	}
+
+	build := &ociBuild{
+		opts:    opts,
+		layout:  layout,
+		matcher: matcher,
+		out:     out,
+		mtime:   start,
+		created: start,
+		image: ocispec.Image{
+			Architecture: runtime.GOARCH,
+			OS:           "linux",
+			RootFS:       ocispec.RootFS{Type: "layers", DiffIDs: []digest.Digest{}},
+		},
+		metaArgs: map[string]string{},
+		args:     map[string]string{},
+	}
+	ctxDigest := ""
+	if opts.Reproducible {
+		build.mtime = sourceTime(opts.Git)
+		build.created = build.mtime
+		d, err := contextDigest(opts.Context, excludes, build.mtime)
+		if err != nil {
+			return nil, err
+		}
+		ctxDigest = d.String()
+		fmt.Fprintf(out, "Context digest: %s\n", ctxDigest)
+	}
+	for i, instruction := range instructions {
+		fmt.Fprintf(out, "Step %d/%d : %s %s\n", i+1, len(instructions), instruction.Cmd, instruction.Raw)
+		if err := b.apply(ctx, build, instruction); err != nil {
+			return nil, contextError(ctx, "Build", fmt.Errorf("line %d: %s", instruction.Line, err))
+		}
+	}
+	if !build.from {
+		return nil, fmt.Errorf("Dockerfile has no FROM instruction")
+	}
+
+	labels := imageLabels(opts, build.created)
+	for key, value := range labels {
+		build.setLabel(key, value)
+	}
+	created := build.created.UTC()
+	build.image.Created = &created
+
+	configJSON, err := json.Marshal(build.image)
+	if err != nil {
+		return nil, err
+	}
+	configDesc, err := layout.WriteBlob(ocispec.MediaTypeImageConfig, configJSON)
+	if err != nil {
+		return nil, err
+	}
+	manifestJSON, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    configDesc,
+		Layers:    build.layers,
+	})
+	if err != nil {
+		return nil, err
+	}
+	manifestDesc, err := layout.WriteBlob(ocispec.MediaTypeImageManifest, manifestJSON)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range opts.Tags {
+		if err := layout.Tag(manifestDesc, tag); err != nil {
+			return nil, err
+		}
+	}
+	fmt.Fprintf(out, "Wrote %s to %s\n", manifestDesc.Digest, layout.Path)
+	if strings.HasSuffix(b.output, ".tar") {
+		if err := b.exportTar(layout, opts.Tags); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(out, "Exported %s\n", b.output)
+	}
+
+	result := &Result{
+		ID:            configDesc.Digest.String(),
+		Tags:          opts.Tags,
+		Size:          imageSize(configDesc, build.layers),
+		Duration:      time.Since(start).Seconds(),
+		ContextDigest: ctxDigest,
+	}
+	if opts.Git != nil {
+		result.Revision = opts.Git.Commit
+	}
+	return result, nil
+}
+
+// Push uploads the blobs the registry is missing and the manifest
+func (b *ociBuilder) Push(ctx context.Context, ref string, out io.Writer) (string, error) {
+	layout, err := b.layout(ref)
+	if err != nil {
+		return "", err
+	}
+	desc, found, err := layout.Resolve(ref)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("Image %s not found in %s", ref, layout.Path)
+	}
+	manifestJSON, err := layout.ReadBlob(desc.Digest)
+	if err != nil {
+		return "", err
+	}
+	manifest, err := layout.Manifest(desc.Digest)
+	if err != nil {
+		return "", err
+	}
+	img, err := registry.ParseImage(ref)
+	if err != nil {
+		return "", err
+	}
+	client, err := registry.NewClient(img.Domain, b.registries)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(out, "The push refers to repository [%s/%s]\n", img.Domain, img.Repository)
+	for _, blob := range append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...) {
+		if err := pushBlob(ctx, client, img.Repository, layout, blob, out); err != nil {
+			return "", contextError(ctx, "Push", err)
+		}
+	}
+	pushed, err := client.PutManifest(ctx, img.Repository, img.Reference, desc.MediaType, manifestJSON)
+	if err != nil {
+		return "", contextError(ctx, "Push", err)
+	}
+	if pushed == "" {
+		pushed = desc.Digest.String()
+	}
+	fmt.Fprintf(out, "%s: digest: %s size: %d\n", img.Reference, pushed, desc.Size)
+	return pushed, nil
+}
+
+func (b *ociBuilder) Lookup(ctx context.Context, ref string) (*Result, bool, error) {
+	layout, err := b.layout(ref)
+	if err != nil {
+		return nil, false, err
+	}
+	desc, found, err := layout.Resolve(ref)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	manifest, err := layout.Manifest(desc.Digest)
+	if err != nil {
+		return nil, false, err
+	}
+	return &Result{
+		ID:   manifest.Config.Digest.String(),
+		Size: imageSize(manifest.Config, manifest.Layers),
+	}, true, nil
+}
+
+func (b *ociBuilder) Tag(ctx context.Context, source string, target string) error {
+	layout, err := b.layout(source)
+	if err != nil {
+		return err
+	}
+	desc, found, err := layout.Resolve(source)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("Image %s not found in %s", source, layout.Path)
+	}
+	return layout.Tag(desc, target)
+}
+
+func (b *ociBuilder) Layers(ctx context.Context, ref string, scan func(layer io.Reader) error) error {
+	layout, err := b.layout(ref)
+	if err != nil {
+		return err
+	}
+	desc, found, err := layout.Resolve(ref)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("Image %s not found in %s", ref, layout.Path)
+	}
+	manifest, err := layout.Manifest(desc.Digest)
+	if err != nil {
+		return err
+	}
+	for _, layer := range manifest.Layers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := scanBlob(layout, layer, scan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// layout opens the layout directory of the builder, when the output is a
+// tar file images are kept in the default layout of the repository
+func (b *ociBuilder) layout(ref string) (*Layout, error) {
+	dir := b.output
+	if dir == "" || strings.HasSuffix(dir, ".tar") {
+		var err error
+		if dir, err = DefaultLayoutPath(ref); err != nil {
+			return nil, err
+		}
+	}
+	return OpenLayout(dir)
+}
+
+func (b *ociBuilder) exportTar(layout *Layout, refs []string) error {
+	f, err := os.Create(b.output)
+	if err != nil {
+		return err
+	}
+	if err := layout.WriteTar(f, refs); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// apply executes a single instruction
+func (b *ociBuilder) apply(ctx context.Context, build *ociBuild, instruction *dockerfile.Instruction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !build.from && instruction.Cmd != "ARG" && instruction.Cmd != "FROM" {
+		return fmt.Errorf("%s before FROM", instruction.Cmd)
+	}
+	args := instruction.Args
+	cfg := &build.image.Config
+	switch instruction.Cmd {
+	case "ARG":
+		for _, arg := range args {
+			kv := strings.SplitN(arg, "=", 2)
+			value := ""
+			switch {
+			case len(kv) == 2:
+				value = build.expand(kv[1])
+			case build.from:
+				// ARG NAME in a stage takes the default of the meta arg
+				value = build.metaArgs[kv[0]]
+			}
+			if v, ok := build.opts.BuildArgs[kv[0]]; ok && v != nil {
+				value = *v
+			}
+			if build.from {
+				build.args[kv[0]] = value
+			} else {
+				build.metaArgs[kv[0]] = value
+			}
+		}
+		return nil
+	case "FROM":
+		if build.from {
+			return fmt.Errorf("Multi-stage builds are not supported by the oci builder")
+		}
+		if len(args) != 1 && !(len(args) == 3 && strings.EqualFold(args[1], "AS")) {
+			return fmt.Errorf("FROM requires an image")
+		}
+		base := build.expand(args[0])
+		build.from = true
+		if base == "scratch" {
+			return nil
+		}
+		return b.pullBase(ctx, build, base)
+	case "ENV":
+		pairs, err := instruction.KeyValues()
+		if err != nil {
+			return err
+		}
+		for _, kv := range pairs {
+			build.setEnv(kv[0], build.expand(kv[1]))
+		}
+	case "LABEL":
+		pairs, err := instruction.KeyValues()
+		if err != nil {
+			return err
+		}
+		for _, kv := range pairs {
+			build.setLabel(build.expand(kv[0]), build.expand(kv[1]))
+		}
+	case "WORKDIR":
+		if len(args) != 1 {
+			return fmt.Errorf("WORKDIR requires exactly one argument")
+		}
+		cfg.WorkingDir = build.path(build.expand(args[0]))
+		return b.workdirLayer(build, instruction)
+	case "USER":
+		if len(args) != 1 {
+			return fmt.Errorf("USER requires exactly one argument")
+		}
+		cfg.User = build.expand(args[0])
+	case "EXPOSE":
+		if cfg.ExposedPorts == nil {
+			cfg.ExposedPorts = map[string]struct{}{}
+		}
+		for _, arg := range args {
+			port := build.expand(arg)
+			if !strings.Contains(port, "/") {
+				port += "/tcp"
+			}
+			cfg.ExposedPorts[port] = struct{}{}
+		}
+	case "CMD":
+		cfg.Cmd = instruction.Command()
+		build.cmdSet = true
+	case "ENTRYPOINT":
+		cfg.Entrypoint = instruction.Command()
+		// like docker, an ENTRYPOINT resets the CMD of the base image
+		if !build.cmdSet {
+			cfg.Cmd = nil
+		}
+	case "COPY":
+		return b.copyLayer(build, instruction)
+	default:
+		return fmt.Errorf("%s is not supported by the oci builder", instruction.Cmd)
+	}
+	build.addHistory(instruction, true)
+	return nil
+}
+
+// pullBase fetches the base image for the platform into the layout and
+// starts the image from its config
+func (b *ociBuilder) pullBase(ctx context.Context, build *ociBuild, base string) error {
+	img, err := registry.ParseImage(base)
+	if err != nil {
+		return err
+	}
+	client, err := registry.NewClient(img.Domain, b.registries)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(build.out, "Pulling %s\n", base)
+	manifestJSON, mediaType, _, err := client.GetManifest(ctx, img.Repository, img.Reference)
+	if err != nil {
+		return err
+	}
+	if mediaType == registry.MediaTypeOCIIndex || mediaType == registry.MediaTypeDockerManifestList {
+		index := &ocispec.Index{}
+		if err := json.Unmarshal(manifestJSON, index); err != nil {
+			return fmt.Errorf("Could not parse index of %s: %s", base, err)
+		}
+		platform := ""
+		for _, m := range index.Manifests {
+			if m.Platform != nil && m.Platform.OS == "linux" && m.Platform.Architecture == runtime.GOARCH {
+				platform = m.Digest.String()
+				break
+			}
+		}
+		if platform == "" {
+			return fmt.Errorf("%s has no image for linux/%s", base, runtime.GOARCH)
+		}
+		if manifestJSON, mediaType, _, err = client.GetManifest(ctx, img.Repository, platform); err != nil {
+			return err
+		}
+	}
+	if mediaType != registry.MediaTypeOCIManifest && mediaType != registry.MediaTypeDockerManifest {
+		return fmt.Errorf("Unsupported manifest type %s for %s", mediaType, base)
+	}
+	manifest := &ocispec.Manifest{}
+	if err := json.Unmarshal(manifestJSON, manifest); err != nil {
+		return fmt.Errorf("Could not parse manifest of %s: %s", base, err)
+	}
+	for _, blob := range append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...) {
+		if build.layout.HasBlob(blob.Digest) {
+			continue
+		}
+		content, err := client.GetBlob(ctx, img.Repository, blob.Digest.String())
+		if err != nil {
+			return err
+		}
+		_, err = build.layout.CopyBlob(blob.Digest, content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	configJSON, err := build.layout.ReadBlob(manifest.Config.Digest)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(configJSON, &build.image); err != nil {
+		return fmt.Errorf("Could not parse config of %s: %s", base, err)
+	}
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == dockerLayerMediaType {
+			layer.MediaType = ocispec.MediaTypeImageLayerGzip
+		}
+		build.layers = append(build.layers, layer)
+	}
+	return nil
+}
+
+// copyEntry is a file of the build context added by COPY
+type copyEntry struct {
+	source string
+	info   os.FileInfo
+	target string
+}
+
+// copyLayer adds a layer with the sources of a COPY instruction
+func (b *ociBuilder) copyLayer(build *ociBuild, instruction *dockerfile.Instruction) error {
+	for flag := range instruction.Flags {
+		if flag != "chown" {
+			return fmt.Errorf("COPY --%s is not supported by the oci builder", flag)
+		}
+	}
+	if len(instruction.Args) < 2 {
+		return fmt.Errorf("COPY requires a source and a destination")
+	}
+	uid, gid, err := parseChown(build.expand(instruction.Flags["chown"]))
+	if err != nil {
+		return err
+	}
+	args := []string{}
+	for _, arg := range instruction.Args {
+		args = append(args, build.expand(arg))
+	}
+	sources, last := args[:len(args)-1], args[len(args)-1]
+	dest := build.path(last)
+	// COPY file . copies into the working directory
+	destIsDir := strings.HasSuffix(last, "/") || path.Base(last) == "." || len(sources) > 1
+
+	entries := []copyEntry{}
+	for _, source := range sources {
+		matches, err := filepath.Glob(filepath.Join(build.opts.Context, filepath.FromSlash(source)))
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("%s not found in build context", source)
+		}
+		if len(matches) > 1 {
+			destIsDir = true
+		}
+		for _, match := range matches {
+			found, err := build.contextFiles(match, dest, destIsDir)
+			if err != nil {
+				return err
+			}
+			if len(found) == 0 {
+				return fmt.Errorf("%s not found in build context or excluded by .dockerignore", source)
+			}
+			entries = append(entries, found...)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].target < entries[j].target
+	})
+
+	err = build.addLayer(func(tw *tar.Writer, written map[string]bool) error {
+		for _, entry := range entries {
+			if err := writeParents(tw, entry.target, written, build.mtime); err != nil {
+				return err
+			}
+			if err := writeEntry(tw, entry, uid, gid, build.mtime, build.opts.Reproducible); err != nil {
+				return err
+			}
+			written[entry.target] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	build.addHistory(instruction, false)
+	return nil
+}
+
+// workdirLayer adds a layer creating the working directory when it is missing
+func (b *ociBuilder) workdirLayer(build *ociBuild, instruction *dockerfile.Instruction) error {
+	dir := build.image.Config.WorkingDir
+	existing, err := build.existingPaths()
+	if err != nil {
+		return err
+	}
+	if existing[dir] {
+		build.addHistory(instruction, true)
+		return nil
+	}
+	err = build.addLayer(func(tw *tar.Writer, written map[string]bool) error {
+		return writeDirs(tw, dir, written, build.mtime)
+	})
+	if err != nil {
+		return err
+	}
+	build.addHistory(instruction, false)
+	return nil
+}
+
+// addLayer adds a gzipped layer with the entries write adds to the tar, write
+// gets the paths in the image so far and adds the paths it writes
+func (build *ociBuild) addLayer(write func(tw *tar.Writer, written map[string]bool) error) error {
+	f, err := ioutil.TempFile(build.layout.Path, "blob-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	compressed := digest.Canonical.Digester()
+	uncompressed := digest.Canonical.Digester()
+	gz := gzip.NewWriter(io.MultiWriter(f, compressed.Hash()))
+	tw := tar.NewWriter(io.MultiWriter(gz, uncompressed.Hash()))
+	written, err := build.existingPaths()
+	if err != nil {
+		return err
+	}
+	if err := write(tw, written); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	layer := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageLayerGzip,
+		Digest:    compressed.Digest(),
+		Size:      info.Size(),
+	}
+	if err := os.Rename(f.Name(), build.layout.BlobPath(layer.Digest)); err != nil {
+		return err
+	}
+	build.layers = append(build.layers, layer)
+	build.image.RootFS.DiffIDs = append(build.image.RootFS.DiffIDs, uncompressed.Digest())
+	return nil
+}
+
+// contextFiles returns the files below source that are not excluded by the
+// .dockerignore. The content of a directory is copied into dest, a file is
+// copied into dest when it is a directory.
+func (build *ociBuild) contextFiles(source string, dest string, destIsDir bool) ([]copyEntry, error) {
+	contextPath, err := filepath.Abs(build.opts.Context)
+	if err != nil {
+		return nil, err
+	}
+	source, err = filepath.Abs(source)
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(contextPath, source); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("%s is outside the build context", source)
+	}
+	entries := []copyEntry{}
+	err = filepath.Walk(source, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(contextPath, p)
+		if err != nil {
+			return err
+		}
+		if rel != "." {
+			excluded, err := build.matcher.Matches(rel)
+			if err != nil {
+				return err
+			}
+			if excluded {
+				if info.IsDir() && !build.matcher.Exclusions() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		target := dest
+		switch {
+		case p == source && info.IsDir():
+			// the directory itself is not copied, only its content
+			return nil
+		case p == source && destIsDir:
+			target = path.Join(dest, info.Name())
+		case p != source:
+			sub, err := filepath.Rel(source, p)
+			if err != nil {
+				return err
+			}
+			target = path.Join(dest, filepath.ToSlash(sub))
+		}
+		entries = append(entries, copyEntry{source: p, info: info, target: target})
+		return nil
+	})
+	return entries, err
+}
+
+// existingPaths returns the paths in the layers of the image so far. The
+// parents of COPY targets are only added to a layer when they are missing,
+// a directory of the base image keeps its mode and owner. Paths added by a
+// COPY layer are added to the result.
+func (build *ociBuild) existingPaths() (map[string]bool, error) {
+	if build.existing != nil {
+		return build.existing, nil
+	}
+	existing := map[string]bool{"/": true}
+	for _, layer := range build.layers {
+		err := scanBlob(build.layout, layer, func(r io.Reader) error {
+			tr := tar.NewReader(r)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				name := path.Clean("/" + hdr.Name)
+				// a removed path is recreated by the runtime when needed
+				if !strings.HasPrefix(path.Base(name), ".wh.") {
+					existing[name] = true
+				}
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Could not read layer %s: %s", layer.Digest, err)
+		}
+	}
+	build.existing = existing
+	return existing, nil
+}
+
+// writeParents adds the parent directories of target missing from written
+// to the layer
+func writeParents(tw *tar.Writer, target string, written map[string]bool, mtime time.Time) error {
+	return writeDirs(tw, path.Dir(target), written, mtime)
+}
+
+// writeDirs adds dir and its parents missing from written to the layer
+func writeDirs(tw *tar.Writer, dir string, written map[string]bool, mtime time.Time) error {
+	dirs := []string{}
+	for d := dir; d != "/" && !written[d]; d = path.Dir(d) {
+		dirs = append([]string{d}, dirs...)
+	}
+	for _, dir := range dirs {
+		hdr := &tar.Header{
+			Name:     strings.TrimPrefix(dir, "/") + "/",
+			Mode:     0755,
+			ModTime:  mtime,
+			Typeflag: tar.TypeDir,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		written[dir] = true
+	}
+	return nil
+}
+
+// writeEntry adds a file, directory or symlink to the layer, for reproducible
+// builds the metadata is normalized and the file times set to mtime
+func writeEntry(tw *tar.Writer, entry copyEntry, uid int, gid int, mtime time.Time, reproducible bool) error {
+	link := ""
+	if entry.info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(entry.source); err != nil {
+			return err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(entry.info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = strings.TrimPrefix(entry.target, "/")
+	if entry.info.IsDir() {
+		hdr.Name += "/"
+	}
+	if reproducible {
+		normalizeHeader(hdr, mtime)
+	}
+	hdr.Uid = uid
+	hdr.Gid = gid
+	hdr.Uname = ""
+	hdr.Gname = ""
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !entry.info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(entry.source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// scanBlob calls scan with the uncompressed content of a layer blob
+func scanBlob(layout *Layout, layer ocispec.Descriptor, scan func(layer io.Reader) error) error {
+	f, err := os.Open(layout.BlobPath(layer.Digest))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	switch {
+	case strings.HasSuffix(layer.MediaType, "gzip"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("Could not read layer %s: %s", layer.Digest, err)
+		}
+		defer gz.Close()
+		return scan(gz)
+	case layer.MediaType == ocispec.MediaTypeImageLayer || strings.HasSuffix(layer.MediaType, ".tar"):
+		return scan(f)
+	}
+	return fmt.Errorf("Unsupported layer media type %s", layer.MediaType)
+}
+
+// pushBlob uploads a blob from the layout unless the repository has it
+func pushBlob(ctx context.Context, client *registry.Client, repository string, layout *Layout, blob ocispec.Descriptor, out io.Writer) error {
+	id := blob.Digest.Encoded()[:12]
+	exists, err := client.BlobExists(ctx, repository, blob.Digest.String())
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Fprintf(out, "%s: Layer already exists\n", id)
+		return nil
+	}
+	open := func() (io.ReadCloser, error) {
+		return os.Open(layout.BlobPath(blob.Digest))
+	}
+	if err := client.PutBlob(ctx, repository, blob.Digest.String(), blob.Size, open); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s: Pushed\n", id)
+	return nil
+}
+
+// parseChown parses the numeric uid[:gid] of COPY --chown, user and group
+// names can not be resolved without running the image
+func parseChown(chown string) (int, int, error) {
+	if chown == "" {
+		return 0, 0, nil
+	}
+	parts := strings.SplitN(chown, ":", 2)
+	uid, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("Only numeric --chown is supported by the oci builder: %s", chown)
+	}
+	gid := uid
+	if len(parts) == 2 {
+		if gid, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, fmt.Errorf("Only numeric --chown is supported by the oci builder: %s", chown)
+		}
+	}
+	return uid, gid, nil
+}
+
+func imageSize(config ocispec.Descriptor, layers []ocispec.Descriptor) int64 {
+	size := config.Size
+	for _, layer := range layers {
+		size += layer.Size
+	}
+	return size
+}
+
+// expand substitutes $VAR and ${VAR} with the environment of the image and
+// the build args of the stage, FROM and the ARG before it only see the meta
+// args
+func (build *ociBuild) expand(s string) string {
+	return os.Expand(s, func(name string) string {
+		if !build.from {
+			return build.metaArgs[name]
+		}
+		if value, ok := build.env(name); ok {
+			return value
+		}
+		return build.args[name]
+	})
+}
+
+func (build *ociBuild) env(name string) (string, bool) {
+	for _, kv := range build.image.Config.Env {
+		if strings.HasPrefix(kv, name+"=") {
+			return strings.TrimPrefix(kv, name+"="), true
+		}
+	}
+	return "", false
+}
+
+func (build *ociBuild) setEnv(name string, value string) {
+	for i, kv := range build.image.Config.Env {
+		if strings.HasPrefix(kv, name+"=") {
+			build.image.Config.Env[i] = name + "=" + value
+			return
+		}
+	}
+	build.image.Config.Env = append(build.image.Config.Env, name+"="+value)
+}
+
+func (build *ociBuild) setLabel(key string, value string) {
+	if build.image.Config.Labels == nil {
+		build.image.Config.Labels = map[string]string{}
+	}
+	build.image.Config.Labels[key] = value
+}
+
+// path resolves p against the working directory of the image
+func (build *ociBuild) path(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	dir := build.image.Config.WorkingDir
+	if dir == "" {
+		dir = "/"
+	}
+	return path.Join(dir, p)
+}
+
+func (build *ociBuild) addHistory(instruction *dockerfile.Instruction, empty bool) {
+	now := time.Now().UTC()
+	if build.opts.Reproducible {
+		now = build.mtime
+	}
+	build.image.History = append(build.image.History, ocispec.History{
+		Created:    &now,
+		CreatedBy:  strings.TrimSpace(fmt.Sprintf("%s %s", instruction.Cmd, instruction.Raw)),
+		EmptyLayer: empty,
+	})
+}
@@ -0,0 +1,138 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// writeFiles writes files by slash separated path below dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// layerHeaders returns the tar headers of a layer
+func layerHeaders(t *testing.T, l *Layout, layer ocispec.Descriptor) []*tar.Header {
+	t.Helper()
+	headers := []*tar.Header{}
+	err := scanBlob(l, layer, func(r io.Reader) error {
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			headers = append(headers, hdr)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return headers
+}
+
+func TestOCIBuild(t *testing.T) {
+	contextDir := tempDir(t)
+	writeFiles(t, contextDir, map[string]string{
+		"Dockerfile": "ARG VERSION=1.0\nARG BASE=scratch\nFROM ${BASE}\nARG VERSION\nARG STAGE=$VERSION\n" +
+			"LABEL version=$VERSION stage=$STAGE base=x$BASE\n" +
+			"COPY app/ /app/bin/\nCOPY conf.yaml /app/conf/\nWORKDIR /app\nWORKDIR data/cache\nCOPY conf.yaml .\nUSER 1000\n",
+		"app/tool":  "tool",
+		"conf.yaml": "conf",
+	})
+	output := tempDir(t)
+	builder, err := NewBuilder(OCIBuilder, output, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-time.Minute)
+	ref := "registry.example.com/app:test"
+	if _, err := builder.Build(context.Background(), &BuildOptions{
+		Context: contextDir,
+		Tags:    []string{ref},
+		Output:  ioutil.Discard,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := OpenLayout(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, found, err := l.Resolve(ref)
+	if err != nil || !found {
+		t.Fatalf("image not tagged: %v %v", found, err)
+	}
+	manifest, err := l.Manifest(desc.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := l.ReadBlob(manifest.Config.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ocispec.Image{}
+	if err := json.Unmarshal(content, &config); err != nil {
+		t.Fatal(err)
+	}
+	// a stage sees the meta args it declares again and none of the others
+	for key, want := range map[string]string{"version": "1.0", "stage": "1.0", "base": "x"} {
+		if got := config.Config.Labels[key]; got != want {
+			t.Errorf("label %s = %q, want %q", key, got, want)
+		}
+	}
+	if config.Config.User != "1000" {
+		t.Errorf("user = %q", config.Config.User)
+	}
+	if config.Config.WorkingDir != "/app/data/cache" {
+		t.Errorf("working dir = %q", config.Config.WorkingDir)
+	}
+
+	if len(manifest.Layers) != 4 {
+		t.Fatalf("%d layers, want 4", len(manifest.Layers))
+	}
+	if config.RootFS.Type != "layers" || len(config.RootFS.DiffIDs) != len(manifest.Layers) {
+		t.Errorf("rootfs = %+v", config.RootFS)
+	}
+	want := [][]string{
+		{"app/", "app/bin/", "app/bin/tool"},
+		// /app is in the first layer and not written again
+		{"app/conf/", "app/conf/conf.yaml"},
+		// WORKDIR /app exists and adds no layer
+		{"app/data/", "app/data/cache/"},
+		{"app/data/cache/conf.yaml"},
+	}
+	for i, layer := range manifest.Layers {
+		names := []string{}
+		for _, hdr := range layerHeaders(t, l, layer) {
+			names = append(names, hdr.Name)
+			if hdr.ModTime.Before(start) {
+				t.Errorf("%s modified at %s, before the build", hdr.Name, hdr.ModTime)
+			}
+		}
+		if !reflect.DeepEqual(names, want[i]) {
+			t.Errorf("layer %d = %v, want %v", i, names, want[i])
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	units "github.com/docker/go-units"
+)
+
+// BuiltImage is an image in the local engine that dev-tool built
+type BuiltImage struct {
+	ID string
+	// Tags are the repository:tag references of the image
+	Tags []string
+	// Digests are the repository@digest references of pushed images
+	Digests []string
+	Created time.Time
+	Size    int64
+}
+
+// Removal is an image, or some of its tags, to remove. When every tag is
+// removed the image itself is deleted and its size reclaimed.
+type Removal struct {
+	Image BuiltImage
+	// Tags to remove, all of them when the image is deleted
+	Tags []string
+	// Deleted is set when no tag is left
+	Deleted bool
+}
+
+// BuiltImages lists the images in the engine with the dev-tool label
+func BuiltImages(ctx context.Context, cli *client.Client) ([]BuiltImage, error) {
+	summaries, err := cli.ImageList(ctx, types.ImageListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", LabelBuiltBy, builtByValue))),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not list images: %s", err)
+	}
+	images := []BuiltImage{}
+	for _, summary := range summaries {
+		image := BuiltImage{
+			ID:      summary.ID,
+			Created: time.Unix(summary.Created, 0),
+			Size:    summary.Size,
+		}
+		for _, tag := range summary.RepoTags {
+			if tag != "<none>:<none>" {
+				image.Tags = append(image.Tags, tag)
+			}
+		}
+		for _, d := range summary.RepoDigests {
+			if d != "<none>@<none>" {
+				image.Digests = append(image.Digests, d)
+			}
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// PlanPrune decides which images to remove. Per repository the keep most
+// recent images are kept, as are images matching a deployed reference, a
+// repository:tag, repository@digest or image id. Untagged images are always
+// removed unless deployed.
+func PlanPrune(images []BuiltImage, keep int, deployed []string) []Removal {
+	isDeployed := deployedMatcher(deployed)
+
+	// tags of each image that are not kept
+	stale := map[string][]string{}
+	byRepository := map[string][]BuiltImage{}
+	for _, image := range images {
+		// an image tagged app:sha and app:latest counts once for app
+		seen := map[string]bool{}
+		for _, tag := range image.Tags {
+			repository := repositoryOf(tag)
+			if !seen[repository] {
+				byRepository[repository] = append(byRepository[repository], image)
+				seen[repository] = true
+			}
+		}
+	}
+	for repository, candidates := range byRepository {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Created.After(candidates[j].Created)
+		})
+		for i, image := range candidates {
+			if i < keep || isDeployed(image) {
+				continue
+			}
+			for _, tag := range image.Tags {
+				if repositoryOf(tag) == repository {
+					stale[image.ID] = append(stale[image.ID], tag)
+				}
+			}
+		}
+	}
+
+	removals := []Removal{}
+	for _, image := range images {
+		if isDeployed(image) {
+			continue
+		}
+		switch {
+		case len(image.Tags) == 0:
+			removals = append(removals, Removal{Image: image, Deleted: true})
+		case len(stale[image.ID]) > 0:
+			sort.Strings(stale[image.ID])
+			removals = append(removals, Removal{
+				Image:   image,
+				Tags:    stale[image.ID],
+				Deleted: len(stale[image.ID]) == len(image.Tags),
+			})
+		}
+	}
+	sort.Slice(removals, func(i, j int) bool {
+		return removals[i].Image.Created.Before(removals[j].Image.Created)
+	})
+	return removals
+}
+
+// Reclaimed returns the bytes freed by the removals. Layers shared with
+// other images are counted as well, the actual space freed may be less.
+func Reclaimed(removals []Removal) int64 {
+	var size int64
+	for _, removal := range removals {
+		if removal.Deleted {
+			size += removal.Image.Size
+		}
+	}
+	return size
+}
+
+// RemoveImages untags the images and deletes those without tags left, it
+// returns the bytes freed like Reclaimed but only counts the images removed.
+// Images that can not be removed, i.e. because a container uses them, are
+// reported and skipped.
+func RemoveImages(ctx context.Context, cli *client.Client, removals []Removal, out io.Writer) (int64, error) {
+	var freed int64
+	failed := 0
+	for _, removal := range removals {
+		targets := removal.Tags
+		if len(targets) == 0 {
+			targets = []string{removal.Image.ID}
+		}
+		removed := true
+		for _, target := range targets {
+			_, err := cli.ImageRemove(ctx, target, types.ImageRemoveOptions{PruneChildren: true})
+			if err != nil && !client.IsErrNotFound(err) {
+				if ctx.Err() != nil {
+					return freed, ctx.Err()
+				}
+				fmt.Fprintf(out, "Could not remove %s: %s\n", target, err)
+				removed = false
+			}
+		}
+		if !removed {
+			failed++
+			continue
+		}
+		if removal.Deleted {
+			freed += removal.Image.Size
+		}
+		PrintRemoval(out, removal, false)
+	}
+	if failed > 0 {
+		return freed, fmt.Errorf("%d images could not be removed", failed)
+	}
+	return freed, nil
+}
+
+// PrintRemoval writes a line describing a removal, for a dry run what would
+// be removed
+func PrintRemoval(out io.Writer, removal Removal, dryRun bool) {
+	name := strings.Join(removal.Tags, ", ")
+	if name == "" {
+		name = "<none>"
+	}
+	deleted, untagged := "Deleted", "Untagged"
+	if dryRun {
+		deleted, untagged = "Would delete", "Would untag"
+	}
+	if removal.Deleted {
+		fmt.Fprintf(out, "%s %s %s (%s, created %s ago)\n", deleted, shortID(removal.Image.ID), name, units.HumanSize(float64(removal.Image.Size)), units.HumanDuration(time.Since(removal.Image.Created)))
+		return
+	}
+	fmt.Fprintf(out, "%s %s %s\n", untagged, shortID(removal.Image.ID), name)
+}
+
+// deployedMatcher returns whether an image is referenced by one of the
+// deployed references
+func deployedMatcher(deployed []string) func(BuiltImage) bool {
+	refs := map[string]bool{}
+	for _, ref := range deployed {
+		refs[normalizeReference(ref)] = true
+	}
+	return func(image BuiltImage) bool {
+		if refs[image.ID] {
+			return true
+		}
+		for _, ref := range append(append([]string{}, image.Tags...), image.Digests...) {
+			if refs[normalizeReference(ref)] {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// normalizeReference returns the fully qualified form of an image reference,
+// the docker-pullable:// prefix of pod image ids is stripped
+func normalizeReference(ref string) string {
+	for _, prefix := range []string{"docker-pullable://", "docker://"} {
+		ref = strings.TrimPrefix(ref, prefix)
+	}
+	if strings.HasPrefix(ref, "sha256:") {
+		return ref
+	}
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ref
+	}
+	return reference.TagNameOnly(named).String()
+}
+
+func repositoryOf(ref string) string {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ref
+	}
+	return named.Name()
+}
+
+func shortID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,174 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// builtImage returns an image created hours ago with tags
+func builtImage(id string, hours int, tags ...string) BuiltImage {
+	return BuiltImage{
+		ID:      "sha256:" + id,
+		Tags:    tags,
+		Created: time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC).Add(-time.Duration(hours) * time.Hour),
+		Size:    100,
+	}
+}
+
+// describeRemovals returns id:tags of every removal, prefixed by deleted when
+// the image is deleted
+func describeRemovals(removals []Removal) []string {
+	result := []string{}
+	for _, r := range removals {
+		what := strings.Join(r.Tags, ",")
+		if r.Deleted {
+			what = "deleted " + what
+		}
+		result = append(result, fmt.Sprintf("%s:%s", shortID(r.Image.ID), strings.TrimSpace(what)))
+	}
+	return result
+}
+
+func TestPlanPrune(t *testing.T) {
+	pushed := builtImage("a2", 2, "registry.example.com/app:v2")
+	pushed.Digests = []string{"registry.example.com/app@sha256:" + strings.Repeat("d", 64)}
+	images := []BuiltImage{
+		builtImage("a1", 1, "registry.example.com/app:v3", "registry.example.com/app:latest"),
+		pushed,
+		builtImage("a3", 3, "registry.example.com/app:v1"),
+		builtImage("b1", 4, "tool:1.0"),
+		builtImage("u1", 5),
+	}
+
+	tests := []struct {
+		name     string
+		images   []BuiltImage
+		keep     int
+		deployed []string
+		want     []string
+	}{
+		{
+			name:   "keep per repository",
+			images: images,
+			keep:   2,
+			want:   []string{"u1:deleted", "a3:deleted registry.example.com/app:v1"},
+		},
+		{
+			name:   "keep none",
+			images: images,
+			keep:   0,
+			want: []string{
+				"u1:deleted",
+				"b1:deleted tool:1.0",
+				"a3:deleted registry.example.com/app:v1",
+				"a2:deleted registry.example.com/app:v2",
+				"a1:deleted registry.example.com/app:latest,registry.example.com/app:v3",
+			},
+		},
+		{
+			name:     "deployed by tag",
+			images:   images,
+			keep:     1,
+			deployed: []string{"registry.example.com/app:v1", "tool:1.0"},
+			want:     []string{"u1:deleted", "a2:deleted registry.example.com/app:v2"},
+		},
+		{
+			name:     "deployed by digest",
+			images:   images,
+			keep:     1,
+			deployed: []string{"docker-pullable://registry.example.com/app@sha256:" + strings.Repeat("d", 64)},
+			want:     []string{"u1:deleted", "a3:deleted registry.example.com/app:v1"},
+		},
+		{
+			name:     "deployed by id",
+			images:   images,
+			keep:     1,
+			deployed: []string{"sha256:a3", "sha256:u1"},
+			want:     []string{"a2:deleted registry.example.com/app:v2"},
+		},
+		{
+			name: "multiple repositories",
+			images: []BuiltImage{
+				builtImage("m1", 1, "app:v2"),
+				builtImage("m2", 2, "app:v1", "mirror.example.com/app:v1"),
+			},
+			keep: 1,
+			want: []string{"m2:app:v1"},
+		},
+		{
+			name:   "untagged only",
+			images: []BuiltImage{builtImage("u1", 1), builtImage("u2", 2)},
+			keep:   5,
+			want:   []string{"u2:deleted", "u1:deleted"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := describeRemovals(PlanPrune(tt.images, tt.keep, tt.deployed))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("removals = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReclaimed(t *testing.T) {
+	removals := []Removal{
+		{Image: builtImage("a", 1), Deleted: true},
+		{Image: builtImage("b", 1), Tags: []string{"app:v1"}},
+	}
+	if got := Reclaimed(removals); got != 100 {
+		t.Errorf("reclaimed %d, want 100", got)
+	}
+}
+
+func TestRemoveImages(t *testing.T) {
+	// the engine refuses to remove the images in use
+	engine := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.Contains(r.URL.Path, "in-use") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"message":"image is being used by a running container"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `[]`)
+	}))
+	defer engine.Close()
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(engine.URL, "http://")), client.WithVersion("1.40"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	removals := []Removal{
+		{Image: builtImage("a1", 3, "app:v1"), Tags: []string{"app:v1"}, Deleted: true},
+		{Image: builtImage("a2", 2, "in-use:v1"), Tags: []string{"in-use:v1"}, Deleted: true},
+		{Image: builtImage("a3", 1, "app:v2", "mirror/app:v2"), Tags: []string{"mirror/app:v2"}},
+		{Image: builtImage("u1", 1), Deleted: true},
+	}
+
+	var out bytes.Buffer
+	freed, err := RemoveImages(context.Background(), cli, removals, &out)
+	if err == nil {
+		t.Error("removing an image in use succeeded")
+	}
+	// the image in use is not counted, untagging frees nothing
+	if freed != 200 {
+		t.Errorf("freed %d, want 200", freed)
+	}
+	if !strings.Contains(out.String(), "Could not remove in-use:v1") {
+		t.Errorf("output %q does not report the image in use", out.String())
+	}
+}
@@ -0,0 +1,72 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/cldmnky/dev-tool/pkg/registry"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/term"
+)
+
+// PushImage pushes a docker image to its registry and returns the manifest
+// digest the registry reported, progress is written to out
+func PushImage(ctx context.Context, cli *client.Client, tag string, registries []config.Registry, out io.Writer) (string, error) {
+	registryAuth, err := getRegistryAuth(tag, registries)
+	if err != nil {
+		return "", err
+	}
+	imagePushOpts := types.ImagePushOptions{
+		RegistryAuth: registryAuth,
+	}
+	pushResp, err := cli.ImagePush(ctx, tag, imagePushOpts)
+	if err != nil {
+		return "", contextError(ctx, "Push", err)
+	}
+	defer pushResp.Close()
+
+	pushResult := types.PushResult{}
+	err = displayStream(pushResp, out, func(msg jsonmessage.JSONMessage) {
+		json.Unmarshal(*msg.Aux, &pushResult)
+	})
+	if err != nil {
+		return "", contextError(ctx, "Push", err)
+	}
+	return pushResult.Digest, nil
+}
+
+// getRegistryAuth returns the encoded credentials for the registry of the image
+func getRegistryAuth(image string, registries []config.Registry) (string, error) {
+	domain, err := registry.Domain(image)
+	if err != nil {
+		return "", err
+	}
+	auth, err := registry.ResolveAuth(domain, registries)
+	if err != nil {
+		return "", fmt.Errorf("Could not resolve credentials for %s: %s", domain, err)
+	}
+	return registry.EncodeAuth(auth)
+}
+
+// contextError replaces err with a readable message when ctx is done
+func contextError(ctx context.Context, phase string, err error) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return fmt.Errorf("%s timed out", phase)
+	case context.Canceled:
+		return fmt.Errorf("%s cancelled", phase)
+	}
+	return err
+}
+
+// displayStream renders a daemon json message stream, an errorDetail in the
+// stream is returned as an error. Aux messages are passed to auxCallback.
+func displayStream(in io.Reader, out io.Writer, auxCallback func(jsonmessage.JSONMessage)) error {
+	termFd, isTerm := term.GetFdInfo(out)
+	return jsonmessage.DisplayJSONMessagesStream(in, out, termFd, isTerm, auxCallback)
+}
@@ -0,0 +1,39 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+)
+
+// Reference assembles an image reference from its parts and normalizes it
+// using the docker reference grammar, i.e. nginx:1 becomes
+// docker.io/library/nginx:1
+func Reference(registry string, repository string, name string, tag string) (string, error) {
+	parts := []string{}
+	for _, part := range []string{registry, repository, name} {
+		part = strings.Trim(part, "/")
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if name == "" {
+		return "", fmt.Errorf("No image name set")
+	}
+	named, err := reference.ParseNormalizedNamed(strings.Join(parts, "/"))
+	if err != nil {
+		return "", fmt.Errorf("Invalid image name %s: %s", strings.Join(parts, "/"), err)
+	}
+	if !reference.IsNameOnly(named) {
+		return "", fmt.Errorf("Image name %s must not contain a tag or digest", named)
+	}
+	if tag == "" {
+		return named.String(), nil
+	}
+	tagged, err := reference.WithTag(named, tag)
+	if err != nil {
+		return "", fmt.Errorf("Invalid tag %s: %s", tag, err)
+	}
+	return tagged.String(), nil
+}
@@ -0,0 +1,83 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	units "github.com/docker/go-units"
+)
+
+// Result describes a built image
+type Result struct {
+	// ID is the local image id
+	ID string `json:"id"`
+	// Digest is the canonical reference, repository@sha256:..., of the
+	// first tag, set once the image is pushed
+	Digest string   `json:"digest,omitempty"`
+	Tags   []string `json:"tags"`
+	// Size of the image in bytes
+	Size int64 `json:"size"`
+	// Duration of the build in seconds
+	Duration float64 `json:"duration"`
+	Revision string  `json:"revision,omitempty"`
+	// Skipped is set when the image for the commit already existed
+	Skipped bool `json:"skipped,omitempty"`
+	// ContextDigest is the digest of the normalized build context of a
+	// reproducible build, equal digests mean identical inputs
+	ContextDigest string `json:"contextDigest,omitempty"`
+	// SBOM is the path of the software bill of materials of the image
+	SBOM string `json:"sbom,omitempty"`
+}
+
+// SetDigest sets the canonical reference from the digest a push of ref
+// reported
+func (r *Result) SetDigest(ref string, digest string) error {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return err
+	}
+	r.Digest = fmt.Sprintf("%s@%s", named.Name(), digest)
+	return nil
+}
+
+// Print writes the result in the given format, text or json
+func (r *Result) Print(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "text", "":
+		if r.Skipped {
+			fmt.Fprintf(w, "Build skipped, image exists\n")
+		}
+		if r.ID != "" {
+			fmt.Fprintf(w, "ID:       %s\n", r.ID)
+		}
+		if r.Digest != "" {
+			fmt.Fprintf(w, "Digest:   %s\n", r.Digest)
+		}
+		if r.Size > 0 {
+			fmt.Fprintf(w, "Size:     %s\n", units.HumanSize(float64(r.Size)))
+		}
+		fmt.Fprintf(w, "Duration: %s\n", time.Duration(r.Duration*float64(time.Second)).Round(time.Millisecond))
+		if r.Revision != "" {
+			fmt.Fprintf(w, "Revision: %s\n", r.Revision)
+		}
+		if r.ContextDigest != "" {
+			fmt.Fprintf(w, "Context:  %s\n", r.ContextDigest)
+		}
+		if r.SBOM != "" {
+			fmt.Fprintf(w, "SBOM:     %s\n", r.SBOM)
+		}
+		for _, tag := range r.Tags {
+			fmt.Fprintf(w, "Tag:      %s\n", tag)
+		}
+		return nil
+	default:
+		return fmt.Errorf("Unknown output format: %s", format)
+	}
+}
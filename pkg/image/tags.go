@@ -0,0 +1,156 @@
+package image
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/cldmnky/dev-tool/pkg/git"
+)
+
+const (
+	maxTagLength = 128
+	dirtySuffix  = "-dirty"
+)
+
+var (
+	invalidTagChars = regexp.MustCompile(`[^\w.-]`)
+	// describeSuffix is the distance and commit git describe appends to a tag
+	// that does not point at the commit
+	describeSuffix = regexp.MustCompile(`^(.+)-(\d+)-g([0-9a-f]+)$`)
+)
+
+// Tags returns the image tags for the git metadata according to the tagging
+// policy, the first tag identifies the commit
+func Tags(policy *config.Tags, info *git.Info) []string {
+	tags := []string{}
+	add := func(tag string) {
+		tag = SanitizeTag(tag)
+		if tag == "" {
+			return
+		}
+		for _, t := range tags {
+			if t == tag {
+				return
+			}
+		}
+		tags = append(tags, tag)
+	}
+
+	if useShortSha(policy) {
+		add(info.ShortCommit())
+	}
+	if policy.Sha {
+		add(info.Commit)
+	}
+	if policy.Branch {
+		add(info.Branch)
+	}
+	if policy.GitTag {
+		add(info.Tag)
+	}
+	if policy.Semver {
+		add(semverTag(info))
+	}
+
+	if info.Dirty {
+		if policy.Dirty {
+			for i := range tags {
+				tags[i] = SanitizeTag(tags[i] + dirtySuffix)
+			}
+		}
+		// never move latest to an uncommitted build
+		return tags
+	}
+	defaultBranch := info.DefaultBranch
+	if policy.DefaultBranch != "" {
+		defaultBranch = policy.DefaultBranch
+	}
+	if policy.Latest && info.Branch != "" && info.Branch == defaultBranch {
+		add("latest")
+	}
+	return tags
+}
+
+// semverTag returns the version of the nearest version tag, empty when the
+// nearest tag is no version. Commits after the tag get the distance and commit
+// as build metadata, 1.2.0+3.gabcdef12, as a pre-release they would sort
+// before the tag. Docker tags do not allow a +, it is replaced by an _ like
+// helm does.
+func semverTag(info *git.Info) string {
+	tag, metadata := info.Tag, ""
+	if tag == "" {
+		m := describeSuffix.FindStringSubmatch(info.Describe)
+		if m == nil {
+			return ""
+		}
+		tag, metadata = m[1], m[2]+".g"+m[3]
+	}
+	v, err := git.ParseSemver(tag)
+	if err != nil {
+		return ""
+	}
+	version := strings.TrimPrefix(tag, "v")
+	if metadata != "" {
+		if v.Metadata() != "" {
+			version += "." + metadata
+		} else {
+			version += "+" + metadata
+		}
+	}
+	return strings.ReplaceAll(version, "+", "_")
+}
+
+// CommitTag returns the tag that identifies the commit under the policy, it
+// is empty when the policy has no sha tag or the worktree is dirty
+func CommitTag(policy *config.Tags, info *git.Info) string {
+	if info.Dirty {
+		return ""
+	}
+	if useShortSha(policy) {
+		return info.ShortCommit()
+	}
+	if policy.Sha {
+		return info.Commit
+	}
+	return ""
+}
+
+// SanitizeTag replaces the characters not allowed in a docker tag and
+// truncates it to the maximum length
+func SanitizeTag(tag string) string {
+	tag = invalidTagChars.ReplaceAllString(tag, "-")
+	tag = strings.TrimLeft(tag, ".-")
+	if len(tag) > maxTagLength {
+		tag = tag[:maxTagLength]
+	}
+	return tag
+}
+
+// DescribePolicy returns a short description of the tagging policy
+func DescribePolicy(policy *config.Tags) string {
+	enabled := []string{}
+	for _, option := range []struct {
+		name string
+		on   bool
+	}{
+		{"shortsha", useShortSha(policy)},
+		{"sha", policy.Sha},
+		{"branch", policy.Branch},
+		{"gittag", policy.GitTag},
+		{"semver", policy.Semver},
+		{"dirty", policy.Dirty},
+		{"latest", policy.Latest},
+	} {
+		if option.on {
+			enabled = append(enabled, option.name)
+		}
+	}
+	return strings.Join(enabled, ", ")
+}
+
+// useShortSha returns whether to tag with the short sha, which is the default
+// when no other tag identifies the build
+func useShortSha(policy *config.Tags) bool {
+	return policy.ShortSha || !(policy.Sha || policy.Branch || policy.GitTag || policy.Semver)
+}
@@ -0,0 +1,76 @@
+package image
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/cldmnky/dev-tool/pkg/git"
+)
+
+func TestTags(t *testing.T) {
+	commit := "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		name   string
+		policy config.Tags
+		info   git.Info
+		want   []string
+	}{
+		{
+			name:   "default branch",
+			policy: config.Tags{ShortSha: true, Branch: true, Latest: true},
+			info:   git.Info{Commit: commit, Branch: "main", DefaultBranch: "main"},
+			want:   []string{"01234567", "main", "latest"},
+		},
+		{
+			name:   "other branch",
+			policy: config.Tags{ShortSha: true, Branch: true, Latest: true},
+			info:   git.Info{Commit: commit, Branch: "feature/x", DefaultBranch: "main"},
+			want:   []string{"01234567", "feature-x"},
+		},
+		{
+			name:   "dirty",
+			policy: config.Tags{ShortSha: true, Latest: true, Dirty: true},
+			info:   git.Info{Commit: commit, Branch: "main", DefaultBranch: "main", Dirty: true},
+			want:   []string{"01234567-dirty"},
+		},
+		{
+			name:   "dirty without the dirty suffix",
+			policy: config.Tags{ShortSha: true, Latest: true},
+			info:   git.Info{Commit: commit, Branch: "main", DefaultBranch: "main", Dirty: true},
+			want:   []string{"01234567"},
+		},
+		{
+			name:   "semver",
+			policy: config.Tags{Semver: true},
+			info:   git.Info{Commit: commit, Tag: "v1.2.0", Describe: "v1.2.0"},
+			want:   []string{"1.2.0"},
+		},
+		{
+			// a pre-release would sort before 1.2.0
+			name:   "semver after the tag",
+			policy: config.Tags{Semver: true},
+			info:   git.Info{Commit: commit, Describe: "v1.2.0-3-g01234567"},
+			want:   []string{"1.2.0_3.g01234567"},
+		},
+		{
+			name:   "semver with build metadata after the tag",
+			policy: config.Tags{Semver: true},
+			info:   git.Info{Commit: commit, Describe: "v1.2.0-rc.1+linux-3-g01234567"},
+			want:   []string{"1.2.0-rc.1_linux.3.g01234567"},
+		},
+		{
+			name:   "describe that is no semver",
+			policy: config.Tags{ShortSha: true, Semver: true},
+			info:   git.Info{Commit: commit, Describe: "release-3-g01234567"},
+			want:   []string{"01234567"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tags(&tt.policy, &tt.info); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tags = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
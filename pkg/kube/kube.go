@@ -0,0 +1,65 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var podsResource = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+// DeployedImages returns the images of the pods in a namespace of the
+// cluster in kubeconfig, all namespaces when namespace is empty. Both the
+// image references of the containers and the image ids reported by the
+// kubelet, repository@digest, are returned.
+func DeployedImages(ctx context.Context, kubeconfig string, namespace string) ([]string, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load kubeconfig %s: %s", kubeconfig, err)
+	}
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := client.Resource(podsResource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Could not list pods in %s: %s", restConfig.Host, err)
+	}
+	images := map[string]bool{}
+	for _, pod := range pods.Items {
+		for _, field := range []string{"containers", "initContainers"} {
+			containers, _, _ := unstructured.NestedSlice(pod.Object, "spec", field)
+			addField(images, containers, "image")
+		}
+		for _, field := range []string{"containerStatuses", "initContainerStatuses"} {
+			statuses, _, _ := unstructured.NestedSlice(pod.Object, "status", field)
+			addField(images, statuses, "image")
+			addField(images, statuses, "imageID")
+		}
+	}
+	result := []string{}
+	for image := range images {
+		result = append(result, image)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// addField adds the string field of every object in the list
+func addField(images map[string]bool, list []interface{}, field string) {
+	for _, item := range list {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if value, ok := object[field].(string); ok && value != "" {
+			images[value] = true
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/cldmnky/dev-tool/pkg/dockerfile"
+)
+
+// Severity of a finding, ordered from info to error
+type Severity int
+
+// Severities of findings
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+// Finding is a rule violation in a Dockerfile
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Message  string   `json:"message"`
+}
+
+// Rule checks the instructions of a Dockerfile
+type Rule struct {
+	ID          string
+	Severity    Severity
+	Description string
+	check       func(instructions []*dockerfile.Instruction) []Finding
+}
+
+// ParseSeverity parses info, warning or error
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(s) {
+	case "info":
+		return Info, nil
+	case "warning", "warn":
+		return Warning, nil
+	case "error":
+		return Error, nil
+	}
+	return Info, fmt.Errorf("Unknown severity: %s", s)
+}
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return "info"
+}
+
+// MarshalJSON writes the severity by name
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Lint checks the Dockerfile at path with the rules that are not disabled in
+// the lint config, findings are sorted by line
+func Lint(path string, cfg *config.Lint) ([]Finding, error) {
+	instructions, err := dockerfile.ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	disabled := map[string]bool{}
+	for _, id := range cfg.Disable {
+		if _, ok := ruleByID(id); !ok {
+			return nil, fmt.Errorf("Unknown lint rule in config: %s", id)
+		}
+		disabled[strings.ToUpper(id)] = true
+	}
+	severities := map[string]Severity{}
+	for id, s := range cfg.Severity {
+		if _, ok := ruleByID(id); !ok {
+			return nil, fmt.Errorf("Unknown lint rule in config: %s", id)
+		}
+		severity, err := ParseSeverity(s)
+		if err != nil {
+			return nil, err
+		}
+		severities[strings.ToUpper(id)] = severity
+	}
+
+	findings := []Finding{}
+	for _, rule := range Rules {
+		if disabled[rule.ID] {
+			continue
+		}
+		severity, ok := severities[rule.ID]
+		if !ok {
+			severity = rule.Severity
+		}
+		for _, finding := range rule.check(instructions) {
+			finding.Rule = rule.ID
+			finding.Severity = severity
+			finding.File = path
+			findings = append(findings, finding)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+// Failed returns whether a finding is at or above the severity
+func Failed(findings []Finding, failOn Severity) bool {
+	for _, finding := range findings {
+		if finding.Severity >= failOn {
+			return true
+		}
+	}
+	return false
+}
+
+// FailOn returns the severity that fails a lint from the config, by default
+// error. none never fails.
+func FailOn(cfg *config.Lint) (Severity, bool, error) {
+	switch cfg.FailOn {
+	case "":
+		return Error, true, nil
+	case "none":
+		return Error, false, nil
+	}
+	severity, err := ParseSeverity(cfg.FailOn)
+	return severity, true, err
+}
+
+// Print writes the findings in the given format, text, json or sarif
+func Print(w io.Writer, findings []Finding, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(findings)
+	case "sarif":
+		return printSarif(w, findings)
+	case "text", "":
+		for _, f := range findings {
+			fmt.Fprintf(w, "%s:%d %s %s %s\n", f.File, f.Line, f.Severity, f.Rule, f.Message)
+		}
+		return nil
+	}
+	return fmt.Errorf("Unknown output format: %s", format)
+}
+
+func ruleByID(id string) (Rule, bool) {
+	for _, rule := range Rules {
+		if strings.EqualFold(rule.ID, id) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
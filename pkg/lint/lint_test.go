@@ -0,0 +1,227 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+)
+
+// writeDockerfile writes a Dockerfile to a temporary directory
+func writeDockerfile(t *testing.T, content string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "dev-tool-lint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "Dockerfile")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// ruleLines returns rule@line of every finding
+func ruleLines(findings []Finding) []string {
+	result := []string{}
+	for _, f := range findings {
+		result = append(result, fmt.Sprintf("%s@%d", f.Rule, f.Line))
+	}
+	return result
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		want       []string
+	}{
+		{
+			name:       "clean",
+			dockerfile: "FROM alpine:3.12\nCOPY app /app\nUSER app\nCMD [\"/app\"]\n",
+			want:       []string{},
+		},
+		{
+			name:       "no user",
+			dockerfile: "FROM alpine:3.12\nCOPY app /app\n",
+			want:       []string{"DT001@1"},
+		},
+		{
+			name:       "user root",
+			dockerfile: "FROM alpine:3.12\nUSER app\nUSER 0:0\n",
+			want:       []string{"DT001@3"},
+		},
+		{
+			name:       "only the final stage needs a user",
+			dockerfile: "FROM golang:1.15 AS build\nRUN go build\nFROM scratch\nUSER 1000\n",
+			want:       []string{},
+		},
+		{
+			name:       "latest and untagged base images",
+			dockerfile: "FROM golang AS build\nFROM alpine:latest\nFROM build\nFROM alpine@sha256:" + strings.Repeat("a", 64) + "\nFROM $BASE\nUSER app\n",
+			want:       []string{"DT002@1", "DT002@2"},
+		},
+		{
+			name:       "add",
+			dockerfile: "FROM scratch\nADD https://example.com/app /app\nADD app.tar.gz /\nADD app /app\nUSER app\n",
+			want:       []string{"DT003@2", "DT004@4"},
+		},
+		{
+			name:       "several commands",
+			dockerfile: "FROM scratch\nCMD a\nENTRYPOINT b\nCMD c\nUSER app\n",
+			want:       []string{"DT005@4"},
+		},
+		{
+			name:       "workdir and cd",
+			dockerfile: "FROM scratch\nWORKDIR app\nWORKDIR /app\nRUN cd src && make\nRUN [\"cd\", \"src\"]\nUSER app\n",
+			want:       []string{"DT006@2", "DT007@4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := Lint(writeDockerfile(t, tt.dockerfile), &config.Lint{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ruleLines(findings); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findings = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLintConfig(t *testing.T) {
+	dockerfile := "FROM alpine\nADD app /app\n"
+	tests := []struct {
+		name    string
+		cfg     config.Lint
+		want    map[string]Severity
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: map[string]Severity{"DT001": Warning, "DT002": Warning, "DT004": Info},
+		},
+		{
+			name: "disabled rules",
+			cfg:  config.Lint{Disable: []string{"dt001", "DT004"}},
+			want: map[string]Severity{"DT002": Warning},
+		},
+		{
+			name: "severity overrides",
+			cfg:  config.Lint{Severity: map[string]string{"DT001": "error", "dt004": "warn"}},
+			want: map[string]Severity{"DT001": Error, "DT002": Warning, "DT004": Warning},
+		},
+		{
+			name:    "unknown disabled rule",
+			cfg:     config.Lint{Disable: []string{"DT999"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown severity",
+			cfg:     config.Lint{Severity: map[string]string{"DT001": "fatal"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := Lint(writeDockerfile(t, dockerfile), &tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("lint succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]Severity{}
+			for _, f := range findings {
+				got[f.Rule] = f.Severity
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("severities = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailOn(t *testing.T) {
+	findings := []Finding{{Rule: "DT002", Severity: Warning}}
+	tests := []struct {
+		failOn   string
+		wantFail bool
+		wantErr  bool
+	}{
+		{failOn: "", wantFail: false},
+		{failOn: "error", wantFail: false},
+		{failOn: "warning", wantFail: true},
+		{failOn: "info", wantFail: true},
+		{failOn: "none", wantFail: false},
+		{failOn: "fatal", wantErr: true},
+	}
+	for _, tt := range tests {
+		severity, fail, err := FailOn(&config.Lint{FailOn: tt.failOn})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("fail on %q succeeded", tt.failOn)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fail && Failed(findings, severity); got != tt.wantFail {
+			t.Errorf("fail on %q = %v, want %v", tt.failOn, got, tt.wantFail)
+		}
+	}
+}
+
+func TestPrintSarif(t *testing.T) {
+	findings := []Finding{
+		{Rule: "DT003", Severity: Error, File: "Dockerfile", Line: 2, Message: "remote"},
+		{Rule: "DT004", Severity: Info, File: "Dockerfile", Line: 3, Message: "local"},
+	}
+	var out bytes.Buffer
+	if err := Print(&out, findings, "sarif"); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != sarifVersion || len(log.Runs) != 1 {
+		t.Fatalf("sarif version %s with %d runs", log.Version, len(log.Runs))
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != len(Rules) {
+		t.Errorf("%d rules in the driver, want %d", len(run.Tool.Driver.Rules), len(Rules))
+	}
+	want := []struct {
+		rule, level string
+		line        int
+	}{
+		{"DT003", "error", 2},
+		{"DT004", "note", 3},
+	}
+	if len(run.Results) != len(want) {
+		t.Fatalf("%d results, want %d", len(run.Results), len(want))
+	}
+	for i, w := range want {
+		r := run.Results[i]
+		if r.RuleID != w.rule || r.Level != w.level || r.Locations[0].PhysicalLocation.Region.StartLine != w.line {
+			t.Errorf("result %d = %s %s line %d, want %s %s line %d", i, r.RuleID, r.Level, r.Locations[0].PhysicalLocation.Region.StartLine, w.rule, w.level, w.line)
+		}
+		if r.Locations[0].PhysicalLocation.ArtifactLocation.URI != "Dockerfile" {
+			t.Errorf("result %d uri = %s", i, r.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+		}
+	}
+}
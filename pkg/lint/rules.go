@@ -0,0 +1,269 @@
+package lint
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/cldmnky/dev-tool/pkg/dockerfile"
+	"github.com/docker/distribution/reference"
+)
+
+// Rules are the checks run on every Dockerfile
+var Rules = []Rule{
+	{
+		ID:          "DT001",
+		Severity:    Warning,
+		Description: "The image runs as root",
+		check:       checkRootUser,
+	},
+	{
+		ID:          "DT002",
+		Severity:    Warning,
+		Description: "Base image without a tag or tagged latest",
+		check:       checkLatestBase,
+	},
+	{
+		ID:          "DT003",
+		Severity:    Error,
+		Description: "ADD of a remote URL",
+		check:       checkAddURL,
+	},
+	{
+		ID:          "DT004",
+		Severity:    Info,
+		Description: "ADD used where COPY suffices",
+		check:       checkAddLocal,
+	},
+	{
+		ID:          "DT005",
+		Severity:    Warning,
+		Description: "Several CMD or ENTRYPOINT instructions in a stage",
+		check:       checkSingleCommand,
+	},
+	{
+		ID:          "DT006",
+		Severity:    Warning,
+		Description: "Relative WORKDIR",
+		check:       checkRelativeWorkdir,
+	},
+	{
+		ID:          "DT007",
+		Severity:    Info,
+		Description: "cd in RUN instead of WORKDIR",
+		check:       checkRunCd,
+	},
+}
+
+// stages splits the instructions at every FROM, instructions before the
+// first FROM are left out
+func stages(instructions []*dockerfile.Instruction) [][]*dockerfile.Instruction {
+	result := [][]*dockerfile.Instruction{}
+	for _, instruction := range instructions {
+		if instruction.Cmd == "FROM" {
+			result = append(result, []*dockerfile.Instruction{})
+		}
+		if len(result) > 0 {
+			result[len(result)-1] = append(result[len(result)-1], instruction)
+		}
+	}
+	return result
+}
+
+// checkRootUser reports a final stage that does not switch to a non root
+// user, base images are not inspected
+func checkRootUser(instructions []*dockerfile.Instruction) []Finding {
+	all := stages(instructions)
+	if len(all) == 0 {
+		return nil
+	}
+	final := all[len(all)-1]
+	var user *dockerfile.Instruction
+	for _, instruction := range final {
+		if instruction.Cmd == "USER" {
+			user = instruction
+		}
+	}
+	if user == nil {
+		return []Finding{{
+			Line:    final[0].Line,
+			Message: "No USER instruction in the final stage, the image runs as root",
+		}}
+	}
+	name := ""
+	if len(user.Args) > 0 {
+		name = strings.SplitN(user.Args[0], ":", 2)[0]
+	}
+	if name == "root" || name == "0" {
+		return []Finding{{
+			Line:    user.Line,
+			Message: fmt.Sprintf("USER %s runs the image as root", user.Raw),
+		}}
+	}
+	return nil
+}
+
+// checkLatestBase reports base images without a tag or digest and images
+// tagged latest, references to earlier stages and build args are skipped
+func checkLatestBase(instructions []*dockerfile.Instruction) []Finding {
+	findings := []Finding{}
+	names := map[string]bool{}
+	for _, instruction := range instructions {
+		if instruction.Cmd != "FROM" || len(instruction.Args) == 0 {
+			continue
+		}
+		image := instruction.Args[0]
+		stage := names[strings.ToLower(image)]
+		if len(instruction.Args) == 3 {
+			names[strings.ToLower(instruction.Args[2])] = true
+		}
+		if image == "scratch" || stage || strings.Contains(image, "$") {
+			continue
+		}
+		named, err := reference.ParseNormalizedNamed(image)
+		if err != nil {
+			findings = append(findings, Finding{
+				Line:    instruction.Line,
+				Message: fmt.Sprintf("Invalid base image %s: %s", image, err),
+			})
+			continue
+		}
+		if _, ok := named.(reference.Digested); ok {
+			continue
+		}
+		tagged, ok := named.(reference.Tagged)
+		switch {
+		case !ok:
+			findings = append(findings, Finding{
+				Line:    instruction.Line,
+				Message: fmt.Sprintf("Base image %s has no tag, pin a version", image),
+			})
+		case tagged.Tag() == "latest":
+			findings = append(findings, Finding{
+				Line:    instruction.Line,
+				Message: fmt.Sprintf("Base image %s uses the latest tag, pin a version", image),
+			})
+		}
+	}
+	return findings
+}
+
+// checkAddURL reports ADD of http and https sources
+func checkAddURL(instructions []*dockerfile.Instruction) []Finding {
+	findings := []Finding{}
+	for _, instruction := range instructions {
+		if instruction.Cmd != "ADD" {
+			continue
+		}
+		for _, source := range sources(instruction) {
+			if isURL(source) {
+				findings = append(findings, Finding{
+					Line:    instruction.Line,
+					Message: fmt.Sprintf("ADD %s downloads without verification, use RUN with a checksum or COPY", source),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// checkAddLocal reports ADD of local files that are not archives
+func checkAddLocal(instructions []*dockerfile.Instruction) []Finding {
+	findings := []Finding{}
+	for _, instruction := range instructions {
+		if instruction.Cmd != "ADD" {
+			continue
+		}
+		plain := true
+		for _, source := range sources(instruction) {
+			if isURL(source) || isArchive(source) {
+				plain = false
+			}
+		}
+		if plain && len(sources(instruction)) > 0 {
+			findings = append(findings, Finding{
+				Line:    instruction.Line,
+				Message: "Use COPY instead of ADD for local files",
+			})
+		}
+	}
+	return findings
+}
+
+// checkSingleCommand reports stages with several CMD or ENTRYPOINT
+// instructions, only the last one takes effect
+func checkSingleCommand(instructions []*dockerfile.Instruction) []Finding {
+	findings := []Finding{}
+	for _, stage := range stages(instructions) {
+		seen := map[string]bool{}
+		for _, instruction := range stage {
+			if instruction.Cmd != "CMD" && instruction.Cmd != "ENTRYPOINT" {
+				continue
+			}
+			if seen[instruction.Cmd] {
+				findings = append(findings, Finding{
+					Line:    instruction.Line,
+					Message: fmt.Sprintf("Several %s instructions, only the last one takes effect", instruction.Cmd),
+				})
+			}
+			seen[instruction.Cmd] = true
+		}
+	}
+	return findings
+}
+
+// checkRelativeWorkdir reports WORKDIR instructions with relative paths
+func checkRelativeWorkdir(instructions []*dockerfile.Instruction) []Finding {
+	findings := []Finding{}
+	for _, instruction := range instructions {
+		if instruction.Cmd != "WORKDIR" || len(instruction.Args) == 0 {
+			continue
+		}
+		dir := instruction.Args[0]
+		if !path.IsAbs(dir) && !strings.HasPrefix(dir, "$") {
+			findings = append(findings, Finding{
+				Line:    instruction.Line,
+				Message: fmt.Sprintf("WORKDIR %s is relative to the previous WORKDIR, use an absolute path", dir),
+			})
+		}
+	}
+	return findings
+}
+
+// checkRunCd reports RUN instructions starting with cd
+func checkRunCd(instructions []*dockerfile.Instruction) []Finding {
+	findings := []Finding{}
+	for _, instruction := range instructions {
+		if instruction.Cmd != "RUN" || instruction.JSON {
+			continue
+		}
+		if len(instruction.Args) > 0 && instruction.Args[0] == "cd" {
+			findings = append(findings, Finding{
+				Line:    instruction.Line,
+				Message: "Use WORKDIR to change the directory",
+			})
+		}
+	}
+	return findings
+}
+
+// sources returns the source arguments of ADD and COPY
+func sources(instruction *dockerfile.Instruction) []string {
+	if len(instruction.Args) < 2 {
+		return nil
+	}
+	return instruction.Args[:len(instruction.Args)-1]
+}
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+func isArchive(source string) bool {
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz"} {
+		if strings.HasSuffix(source, ext) {
+			return true
+		}
+	}
+	return false
+}
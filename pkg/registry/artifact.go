@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// emptyConfigMediaType is the config of artifacts that carry no config
+const emptyConfigMediaType = "application/vnd.oci.empty.v1+json"
+
+// artifactManifest is an OCI image manifest carrying a single blob that
+// refers to another manifest through its subject
+type artifactManifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	ArtifactType  string       `json:"artifactType"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+	Subject       *descriptor  `json:"subject,omitempty"`
+}
+
+// AttachArtifact uploads content as an artifact referring to the manifest
+// with digest subject. Registries with the referrers API list it with the
+// image, the artifact is also tagged sha256-<hex>.<suffix> so that it can be
+// found on registries without it. The artifact reference is returned.
+func (c *Client) AttachArtifact(ctx context.Context, repository string, subject string, artifactType string, suffix string, content []byte) (string, error) {
+	subjectDigest, err := digest.Parse(subject)
+	if err != nil {
+		return "", fmt.Errorf("Invalid subject digest %s: %s", subject, err)
+	}
+	manifest, mediaType, _, err := c.GetManifest(ctx, repository, subject)
+	if err != nil {
+		return "", err
+	}
+
+	config := []byte("{}")
+	configDesc := descriptor{MediaType: emptyConfigMediaType, Digest: digest.FromBytes(config), Size: int64(len(config))}
+	if err := c.putBlobOnce(ctx, repository, configDesc, config); err != nil {
+		return "", err
+	}
+	layer := descriptor{MediaType: artifactType, Digest: digest.FromBytes(content), Size: int64(len(content))}
+	if err := c.putBlobOnce(ctx, repository, layer, content); err != nil {
+		return "", err
+	}
+
+	artifact, err := json.Marshal(artifactManifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		ArtifactType:  artifactType,
+		Config:        configDesc,
+		Layers:        []descriptor{layer},
+		Subject: &descriptor{
+			MediaType: mediaType,
+			Digest:    subjectDigest,
+			Size:      int64(len(manifest)),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	tag := fmt.Sprintf("%s-%s.%s", subjectDigest.Algorithm(), subjectDigest.Hex(), strings.TrimPrefix(suffix, "."))
+	if _, err := c.PutManifest(ctx, repository, tag, MediaTypeOCIManifest, artifact); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s:%s", c.Host(), repository, tag), nil
+}
+
+// putBlobOnce uploads a blob unless the repository has it
+func (c *Client) putBlobOnce(ctx context.Context, repository string, blob descriptor, content []byte) error {
+	exists, err := c.BlobExists(ctx, repository, blob.Digest.String())
+	if err != nil || exists {
+		return err
+	}
+	return c.PutBlob(ctx, repository, blob.Digest.String(), blob.Size, func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	})
+}
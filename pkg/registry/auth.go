@@ -0,0 +1,187 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+const (
+	// DockerHubServer is the key docker uses for Docker Hub credentials
+	DockerHubServer = "https://index.docker.io/v1/"
+	dockerHubDomain = "docker.io"
+
+	credentialsNotFound = "credentials not found in native keychain"
+	identityTokenUser   = "<token>"
+)
+
+// DockerConfig is the subset of ~/.docker/config.json used for registry auth
+type DockerConfig struct {
+	Auths       map[string]types.AuthConfig `json:"auths"`
+	CredsStore  string                      `json:"credsStore,omitempty"`
+	CredHelpers map[string]string           `json:"credHelpers,omitempty"`
+}
+
+type helperCredentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// LoadDockerConfig reads the docker config file, honoring DOCKER_CONFIG.
+// A missing file yields an empty config.
+func LoadDockerConfig() (*DockerConfig, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	dockerConfig := &DockerConfig{}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return dockerConfig, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(content, dockerConfig); err != nil {
+		return nil, fmt.Errorf("Could not parse docker config: %s", err)
+	}
+	return dockerConfig, nil
+}
+
+// Domain returns the registry host of an image reference
+func Domain(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	return reference.Domain(named), nil
+}
+
+// ResolveAuth returns the credentials for a registry host. Registries
+// declared in dev-tool.yaml win, then credHelpers, credsStore and finally
+// the plain auths entries of the docker config.
+func ResolveAuth(host string, registries []config.Registry) (types.AuthConfig, error) {
+	server := host
+	if hostname(host) == dockerHubDomain {
+		// the docker cli keeps Docker Hub credentials under the index url
+		server = DockerHubServer
+	}
+	for _, r := range registries {
+		if hostname(r.Host) == hostname(server) {
+			return types.AuthConfig{
+				Username:      r.Username,
+				Password:      r.Password,
+				ServerAddress: server,
+			}, nil
+		}
+	}
+
+	dockerConfig, err := LoadDockerConfig()
+	if err != nil {
+		return types.AuthConfig{}, err
+	}
+	if helper, ok := credHelper(dockerConfig.CredHelpers, server); ok {
+		return helperAuth(helper, server)
+	}
+	if dockerConfig.CredsStore != "" {
+		return helperAuth(dockerConfig.CredsStore, server)
+	}
+	for key, auth := range dockerConfig.Auths {
+		if hostname(key) != hostname(server) {
+			continue
+		}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return types.AuthConfig{}, fmt.Errorf("Invalid auth for %s: %s", key, err)
+			}
+			creds := strings.SplitN(string(decoded), ":", 2)
+			if len(creds) != 2 {
+				return types.AuthConfig{}, fmt.Errorf("Invalid auth for %s", key)
+			}
+			auth.Username = creds[0]
+			auth.Password = creds[1]
+			auth.Auth = ""
+		}
+		auth.ServerAddress = server
+		return auth, nil
+	}
+	return types.AuthConfig{ServerAddress: server}, nil
+}
+
+// credHelper returns the credential helper configured for the server, keys
+// are matched by their host so docker.io finds the Docker Hub entry
+func credHelper(helpers map[string]string, server string) (string, bool) {
+	if helper, ok := helpers[server]; ok {
+		return helper, true
+	}
+	for key, helper := range helpers {
+		if hostname(key) == hostname(server) {
+			return helper, true
+		}
+	}
+	return "", false
+}
+
+// EncodeAuth encodes credentials for the X-Registry-Auth header
+func EncodeAuth(auth types.AuthConfig) (string, error) {
+	buf, err := json.Marshal(auth)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(buf), nil
+}
+
+// helperAuth runs docker-credential-<helper> get for the server
+func helperAuth(helper string, server string) (types.AuthConfig, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(fmt.Sprintf("docker-credential-%s", helper), "get")
+	cmd.Stdin = strings.NewReader(server)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stdout.String(), credentialsNotFound) {
+			return types.AuthConfig{ServerAddress: server}, nil
+		}
+		return types.AuthConfig{}, fmt.Errorf("Credential helper %s failed: %s %s", helper, err, strings.TrimSpace(stderr.String()))
+	}
+	creds := &helperCredentials{}
+	if err := json.Unmarshal(stdout.Bytes(), creds); err != nil {
+		return types.AuthConfig{}, fmt.Errorf("Could not parse output of credential helper %s: %s", helper, err)
+	}
+	auth := types.AuthConfig{ServerAddress: server}
+	if creds.Username == identityTokenUser {
+		auth.IdentityToken = creds.Secret
+	} else {
+		auth.Username = creds.Username
+		auth.Password = creds.Secret
+	}
+	return auth, nil
+}
+
+// hostname strips scheme and path from a registry address
+func hostname(address string) string {
+	host := strings.TrimPrefix(address, "http://")
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.SplitN(host, "/", 2)[0]
+	if host == "index.docker.io" || host == "registry-1.docker.io" {
+		return dockerHubDomain
+	}
+	return host
+}
@@ -0,0 +1,121 @@
+package registry
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+)
+
+// dockerConfigDir points DOCKER_CONFIG to a directory with the config.json
+// and PATH to a docker-credential-test helper answering with the server it
+// was asked for as the user
+func dockerConfigDir(t *testing.T, dockerConfig string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential helper is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "dev-tool-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	helper := "#!/bin/sh\nread server\necho \"{\\\"ServerURL\\\":\\\"$server\\\",\\\"Username\\\":\\\"$server\\\",\\\"Secret\\\":\\\"helper-secret\\\"}\"\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "docker-credential-test"), []byte(helper), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(dockerConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{
+		"DOCKER_CONFIG": dir,
+		"PATH":          dir + string(os.PathListSeparator) + os.Getenv("PATH"),
+	} {
+		old, set := os.LookupEnv(name)
+		os.Setenv(name, value)
+		t.Cleanup(func() {
+			if set {
+				os.Setenv(name, old)
+			} else {
+				os.Unsetenv(name)
+			}
+		})
+	}
+}
+
+func TestResolveAuth(t *testing.T) {
+	basic := base64.StdEncoding.EncodeToString([]byte("hub-user:hub-secret"))
+	tests := []struct {
+		name         string
+		dockerConfig string
+		host         string
+		registries   []config.Registry
+		wantUser     string
+		wantPassword string
+		wantServer   string
+	}{
+		{
+			name:         "docker hub cred helper",
+			dockerConfig: `{"credHelpers":{"https://index.docker.io/v1/":"test"}}`,
+			host:         "docker.io",
+			wantUser:     DockerHubServer,
+			wantPassword: "helper-secret",
+			wantServer:   DockerHubServer,
+		},
+		{
+			name:         "docker hub cred helper for the index host",
+			dockerConfig: `{"credHelpers":{"https://index.docker.io/v1/":"test"}}`,
+			host:         "index.docker.io",
+			wantUser:     DockerHubServer,
+			wantPassword: "helper-secret",
+			wantServer:   DockerHubServer,
+		},
+		{
+			name:         "cred helper by host",
+			dockerConfig: `{"credHelpers":{"registry.example.com":"test"},"credsStore":"missing"}`,
+			host:         "registry.example.com",
+			wantUser:     "registry.example.com",
+			wantPassword: "helper-secret",
+			wantServer:   "registry.example.com",
+		},
+		{
+			name:         "docker hub auths",
+			dockerConfig: `{"auths":{"https://index.docker.io/v1/":{"auth":"` + basic + `"}}}`,
+			host:         "docker.io",
+			wantUser:     "hub-user",
+			wantPassword: "hub-secret",
+			wantServer:   DockerHubServer,
+		},
+		{
+			name:         "registries of the config win",
+			dockerConfig: `{"credHelpers":{"https://index.docker.io/v1/":"test"}}`,
+			host:         "docker.io",
+			registries:   []config.Registry{{Host: "index.docker.io", Username: "config-user", Password: "config-secret"}},
+			wantUser:     "config-user",
+			wantPassword: "config-secret",
+			wantServer:   DockerHubServer,
+		},
+		{
+			name:         "no credentials",
+			dockerConfig: `{"auths":{"https://index.docker.io/v1/":{"auth":"` + basic + `"}}}`,
+			host:         "registry.example.com",
+			wantServer:   "registry.example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dockerConfigDir(t, tt.dockerConfig)
+			auth, err := ResolveAuth(tt.host, tt.registries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if auth.Username != tt.wantUser || auth.Password != tt.wantPassword || auth.ServerAddress != tt.wantServer {
+				t.Errorf("auth = %s:%s for %s, want %s:%s for %s", auth.Username, auth.Password, auth.ServerAddress, tt.wantUser, tt.wantPassword, tt.wantServer)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// BlobExists checks whether the repository has a blob
+func (c *Client) BlobExists(ctx context.Context, repository string, digest string) (bool, error) {
+	resp, err := c.do(ctx, http.MethodHead, repository, "pull", fmt.Sprintf("/v2/%s/blobs/%s", repository, digest), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("Unexpected status looking up blob %s: %s", digest, resp.Status)
+}
+
+// GetBlob returns the content of a blob, the caller has to close it
+func (c *Client) GetBlob(ctx context.Context, repository string, digest string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, repository, "pull", fmt.Sprintf("/v2/%s/blobs/%s", repository, digest), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError(resp, fmt.Sprintf("get blob %s", digest))
+	}
+	return resp.Body, nil
+}
+
+// PutBlob uploads a blob in a single request. The content is opened for
+// every attempt, a token that expires during the upload is renewed and the
+// upload started over.
+func (c *Client) PutBlob(ctx context.Context, repository string, digest string, size int64, open func() (io.ReadCloser, error)) error {
+	for attempt := 0; ; attempt++ {
+		resp, err := c.uploadBlob(ctx, repository, digest, size, open)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if err := c.authenticate(ctx, challenge, repositoryScope(repository, "pull,push")); err != nil {
+				return err
+			}
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			return responseError(resp, fmt.Sprintf("upload %s", digest))
+		}
+		return nil
+	}
+}
+
+// uploadBlob starts an upload and returns the response to the PUT of the
+// content
+func (c *Client) uploadBlob(ctx context.Context, repository string, digest string, size int64, open func() (io.ReadCloser, error)) (*http.Response, error) {
+	resp, err := c.do(ctx, http.MethodPost, repository, "pull,push", fmt.Sprintf("/v2/%s/blobs/uploads/", repository), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		defer resp.Body.Close()
+		return nil, responseError(resp, fmt.Sprintf("start upload of %s", digest))
+	}
+	resp.Body.Close()
+	location, err := c.location(resp)
+	if err != nil {
+		return nil, err
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	content, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	req, err := http.NewRequest(http.MethodPut, location.String(), content)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	c.authorize(req, repositoryScope(repository, "pull,push"))
+	return c.http.Do(req)
+}
+
+// location resolves the Location header of an upload response
+func (c *Client) location(resp *http.Response) (*url.URL, error) {
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return nil, err
+	}
+	base := &url.URL{Scheme: c.scheme, Host: c.host}
+	return base.ResolveReference(location), nil
+}
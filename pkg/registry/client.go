@@ -0,0 +1,334 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+)
+
+// Manifest media types accepted from a registry
+const (
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+
+	dockerHubRegistry   = "registry-1.docker.io"
+	contentDigestHeader = "Docker-Content-Digest"
+)
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+var manifestMediaTypes = []string{
+	MediaTypeOCIManifest,
+	MediaTypeOCIIndex,
+	MediaTypeDockerManifest,
+	MediaTypeDockerManifestList,
+}
+
+// Client talks to a registry using the distribution v2 API
+type Client struct {
+	host   string
+	scheme string
+	auth   types.AuthConfig
+	http   *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// Image is a parsed image reference
+type Image struct {
+	Domain     string
+	Repository string
+	// Reference is the tag or digest
+	Reference string
+}
+
+// ParseImage splits an image reference into registry, repository and tag or
+// digest, the tag defaults to latest
+func ParseImage(image string) (*Image, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, err
+	}
+	img := &Image{
+		Domain:     reference.Domain(named),
+		Repository: reference.Path(named),
+		Reference:  "latest",
+	}
+	if canonical, ok := named.(reference.Canonical); ok {
+		img.Reference = canonical.Digest().String()
+	} else if tagged, ok := named.(reference.Tagged); ok {
+		img.Reference = tagged.Tag()
+	}
+	return img, nil
+}
+
+// NewClient returns a client for the registry host, credentials are resolved
+// from the registries in the config and the docker config
+func NewClient(host string, registries []config.Registry) (*Client, error) {
+	auth, err := ResolveAuth(host, registries)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		host:   host,
+		scheme: "https",
+		auth:   auth,
+		http:   &http.Client{},
+		tokens: map[string]string{},
+	}
+	if host == dockerHubDomain {
+		c.host = dockerHubRegistry
+	}
+	if isInsecure(host, registries) {
+		c.scheme = "http"
+	}
+	return c, nil
+}
+
+// Host returns the registry host the client talks to
+func (c *Client) Host() string {
+	return c.host
+}
+
+// HeadManifest returns the digest of a manifest, found is false when the
+// registry does not know the reference
+func (c *Client) HeadManifest(ctx context.Context, repository string, ref string) (digest string, found bool, err error) {
+	resp, err := c.do(ctx, http.MethodHead, repository, "pull", fmt.Sprintf("/v2/%s/manifests/%s", repository, ref), nil, http.Header{
+		"Accept": manifestMediaTypes,
+	})
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Header.Get(contentDigestHeader), true, nil
+	case http.StatusNotFound:
+		return "", false, nil
+	}
+	return "", false, fmt.Errorf("Unexpected status looking up %s:%s: %s", repository, ref, resp.Status)
+}
+
+// GetManifest returns a manifest with its media type and digest
+func (c *Client) GetManifest(ctx context.Context, repository string, ref string) ([]byte, string, string, error) {
+	resp, err := c.do(ctx, http.MethodGet, repository, "pull", fmt.Sprintf("/v2/%s/manifests/%s", repository, ref), nil, http.Header{
+		"Accept": manifestMediaTypes,
+	})
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", "", responseError(resp, fmt.Sprintf("get manifest %s:%s", repository, ref))
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return body, resp.Header.Get("Content-Type"), resp.Header.Get(contentDigestHeader), nil
+}
+
+// PutManifest uploads a manifest under a tag or digest and returns the digest
+// the registry reported
+func (c *Client) PutManifest(ctx context.Context, repository string, ref string, mediaType string, manifest []byte) (string, error) {
+	resp, err := c.do(ctx, http.MethodPut, repository, "pull,push", fmt.Sprintf("/v2/%s/manifests/%s", repository, ref), manifest, http.Header{
+		"Content-Type": []string{mediaType},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", responseError(resp, fmt.Sprintf("put manifest %s:%s", repository, ref))
+	}
+	return resp.Header.Get(contentDigestHeader), nil
+}
+
+// Tag points tag at the manifest of source within the same repository
+// without pulling any layers
+func (c *Client) Tag(ctx context.Context, repository string, source string, tag string) (string, error) {
+	manifest, mediaType, _, err := c.GetManifest(ctx, repository, source)
+	if err != nil {
+		return "", err
+	}
+	return c.PutManifest(ctx, repository, tag, mediaType, manifest)
+}
+
+// do sends a request, authenticating with the registry when challenged
+func (c *Client) do(ctx context.Context, method string, repository string, actions string, path string, body []byte, header http.Header) (*http.Response, error) {
+	return c.doScope(ctx, method, repositoryScope(repository, actions), path, body, header)
+}
+
+// doScope sends a request authenticated for scope, which holds space
+// separated scopes like repository:name:pull
+func (c *Client) doScope(ctx context.Context, method string, scope string, path string, body []byte, header http.Header) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, fmt.Sprintf("%s://%s%s", c.scheme, c.host, path), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if body != nil {
+			req.ContentLength = int64(len(body))
+		}
+		c.authorize(req, scope)
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := c.authenticate(ctx, challenge, scope); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// authorize sets the token for the scope or basic credentials
+func (c *Client) authorize(req *http.Request, scope string) {
+	c.mu.Lock()
+	token, ok := c.tokens[scope]
+	c.mu.Unlock()
+	switch {
+	case ok && token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case ok && c.auth.Username != "":
+		req.SetBasicAuth(c.auth.Username, c.auth.Password)
+	}
+}
+
+// authenticate handles a WWW-Authenticate challenge, for Bearer challenges a
+// token is fetched from the realm
+func (c *Client) authenticate(ctx context.Context, challenge string, scope string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.auth.Username == "" {
+			return fmt.Errorf("Registry %s requires credentials", c.host)
+		}
+		c.setToken(scope, "")
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("Unsupported authentication challenge from %s: %s", c.host, challenge)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("Invalid realm in challenge from %s: %s", c.host, challenge)
+	}
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query["scope"] = strings.Fields(scope)
+
+	var req *http.Request
+	if c.auth.IdentityToken != "" {
+		form := url.Values{
+			"grant_type":    []string{"refresh_token"},
+			"refresh_token": []string{c.auth.IdentityToken},
+			"service":       []string{params["service"]},
+			"scope":         []string{scope},
+			"client_id":     []string{"dev-tool"},
+		}
+		req, err = http.NewRequest(http.MethodPost, realm.String(), strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		realm.RawQuery = query.Encode()
+		req, err = http.NewRequest(http.MethodGet, realm.String(), nil)
+		if err != nil {
+			return err
+		}
+		if c.auth.Username != "" {
+			req.SetBasicAuth(c.auth.Username, c.auth.Password)
+		}
+	}
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp, fmt.Sprintf("get token from %s", realm.Host))
+	}
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	c.setToken(scope, token.Token)
+	return nil
+}
+
+// repositoryScope returns the token scope of actions on a repository
+func repositoryScope(repository string, actions string) string {
+	return fmt.Sprintf("repository:%s:%s", repository, actions)
+}
+
+func (c *Client) setToken(scope string, token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[scope] = token
+}
+
+// parseChallenge parses a WWW-Authenticate header like
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+	for _, match := range challengeParam.FindAllStringSubmatch(parts[1], -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+	return parts[0], params
+}
+
+// responseError turns an unexpected registry response into an error
+func responseError(resp *http.Response, action string) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("Could not %s: %s %s", action, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// isInsecure returns whether to use plain http, which is the case for
+// registries on localhost and registries marked insecure in the config
+func isInsecure(host string, registries []config.Registry) bool {
+	for _, r := range registries {
+		if hostname(r.Host) == host && r.Insecure {
+			return true
+		}
+	}
+	name := strings.Split(host, ":")[0]
+	return name == "localhost" || name == "127.0.0.1"
+}
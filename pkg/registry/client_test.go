@@ -0,0 +1,290 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cldmnky/dev-tool/pkg/config"
+	digest "github.com/opencontainers/go-digest"
+)
+
+const (
+	testUser     = "user"
+	testPassword = "secret"
+)
+
+var (
+	manifestPath = regexp.MustCompile(`^/v2/(.+)/manifests/([^/]+)$`)
+	uploadPath   = regexp.MustCompile(`^/v2/(.+)/blobs/uploads/([^/]*)$`)
+)
+
+type fakeManifest struct {
+	mediaType string
+	content   []byte
+}
+
+// fakeRegistry serves manifests and blob mounts of the distribution API, with
+// tokens set requests need a bearer token for the repository from its /token
+// endpoint
+type fakeRegistry struct {
+	*httptest.Server
+	tokens bool
+
+	mu        sync.Mutex
+	manifests map[string]fakeManifest
+	// blobs holds repository@digest of the blobs
+	blobs map[string]bool
+	// scopes are the scopes tokens were requested for
+	scopes []string
+	// expirePuts is the number of blob uploads refused as if the token
+	// expired during the upload
+	expirePuts int
+}
+
+func newFakeRegistry(t *testing.T, tokens bool) *fakeRegistry {
+	t.Helper()
+	r := &fakeRegistry{tokens: tokens, manifests: map[string]fakeManifest{}, blobs: map[string]bool{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// host is the host:port of the registry, plain http is used for 127.0.0.1
+func (r *fakeRegistry) host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+func (r *fakeRegistry) client(t *testing.T) *Client {
+	t.Helper()
+	c, err := NewClient(r.host(), []config.Registry{{Host: r.host(), Username: testUser, Password: testPassword}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (r *fakeRegistry) putManifest(repository string, ref string, m fakeManifest) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := digest.FromBytes(m.content).String()
+	r.manifests[repository+":"+ref] = m
+	r.manifests[repository+":"+d] = m
+	return d
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		r.token(w, req)
+		return
+	}
+	m := manifestPath.FindStringSubmatch(req.URL.Path)
+	upload := uploadPath.FindStringSubmatch(req.URL.Path)
+	repository := ""
+	switch {
+	case m != nil:
+		repository = m[1]
+	case upload != nil:
+		repository = upload[1]
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	if !r.authorized(req, repository) {
+		r.challenge(w)
+		return
+	}
+	if m != nil {
+		r.manifest(w, req, m[1], m[2])
+		return
+	}
+	r.upload(w, req, upload[1])
+}
+
+// challenge answers that a token is needed
+func (r *fakeRegistry) challenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="`+r.URL+`/token",service="fake"`)
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+// upload mounts a blob when the token allows pulling it from the source
+// repository and starts an upload otherwise, a PUT completes the upload
+func (r *fakeRegistry) upload(w http.ResponseWriter, req *http.Request, repository string) {
+	switch req.Method {
+	case http.MethodPost:
+		d, from := req.URL.Query().Get("mount"), req.URL.Query().Get("from")
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if d != "" && r.blobs[from+"@"+d] && (!r.tokens || hasScope(req, "repository:"+from+":pull")) {
+			r.blobs[repository+"@"+d] = true
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.Header().Set("Location", "/v2/"+repository+"/blobs/uploads/1")
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		content, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.expirePuts > 0 {
+			r.expirePuts--
+			r.challenge(w)
+			return
+		}
+		d := req.URL.Query().Get("digest")
+		if digest.FromBytes(content).String() != d {
+			http.Error(w, `{"errors":[{"code":"DIGEST_INVALID"}]}`, http.StatusBadRequest)
+			return
+		}
+		r.blobs[repository+"@"+d] = true
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// token issues a token holding the requested scopes to the test user
+func (r *fakeRegistry) token(w http.ResponseWriter, req *http.Request) {
+	if user, password, ok := req.BasicAuth(); !ok || user != testUser || password != testPassword {
+		http.Error(w, `{"errors":[{"code":"UNAUTHORIZED"}]}`, http.StatusUnauthorized)
+		return
+	}
+	scopes := req.URL.Query()["scope"]
+	r.mu.Lock()
+	r.scopes = append(r.scopes, scopes...)
+	r.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]string{"token": strings.Join(scopes, " ")})
+}
+
+// authorized returns whether the request has a token for the repository
+func (r *fakeRegistry) authorized(req *http.Request, repository string) bool {
+	if !r.tokens {
+		return true
+	}
+	return hasScope(req, "repository:"+repository+":")
+}
+
+// hasScope returns whether the bearer token of the request has a scope
+// starting with prefix
+func hasScope(req *http.Request, prefix string) bool {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	for _, scope := range strings.Fields(token) {
+		if strings.HasPrefix(scope, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *fakeRegistry) manifest(w http.ResponseWriter, req *http.Request, repository string, ref string) {
+	switch req.Method {
+	case http.MethodHead, http.MethodGet:
+		r.mu.Lock()
+		m, ok := r.manifests[repository+":"+ref]
+		r.mu.Unlock()
+		if !ok {
+			http.Error(w, `{"errors":[{"code":"MANIFEST_UNKNOWN"}]}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set(contentDigestHeader, digest.FromBytes(m.content).String())
+		if req.Method == http.MethodGet {
+			w.Write(m.content)
+		}
+	case http.MethodPut:
+		content, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d := r.putManifest(repository, ref, fakeManifest{mediaType: req.Header.Get("Content-Type"), content: content})
+		w.Header().Set(contentDigestHeader, d)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+var testManifest = fakeManifest{
+	mediaType: MediaTypeOCIManifest,
+	content:   []byte(`{"schemaVersion":2,"layers":[]}`),
+}
+
+func TestHeadManifest(t *testing.T) {
+	for _, tokens := range []bool{false, true} {
+		r := newFakeRegistry(t, tokens)
+		want := r.putManifest("team/app", "abc1234", testManifest)
+		c := r.client(t)
+
+		d, found, err := c.HeadManifest(context.Background(), "team/app", "abc1234")
+		if err != nil || !found || d != want {
+			t.Errorf("tokens %v: head existing = %s %v %v, want %s", tokens, d, found, err, want)
+		}
+		d, found, err = c.HeadManifest(context.Background(), "team/app", "missing")
+		if err != nil || found || d != "" {
+			t.Errorf("tokens %v: head missing = %s %v %v", tokens, d, found, err)
+		}
+		if tokens && !contains(r.scopes, "repository:team/app:pull") {
+			t.Errorf("token scopes %v, want repository:team/app:pull", r.scopes)
+		}
+	}
+}
+
+func TestHeadManifestUnauthorized(t *testing.T) {
+	r := newFakeRegistry(t, true)
+	r.putManifest("team/app", "abc1234", testManifest)
+	c, err := NewClient(r.host(), []config.Registry{{Host: r.host(), Username: testUser, Password: "wrong"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := c.HeadManifest(context.Background(), "team/app", "abc1234"); err == nil || found {
+		t.Errorf("head with wrong credentials = %v %v, want an error", found, err)
+	} else if !strings.Contains(err.Error(), "UNAUTHORIZED") {
+		t.Errorf("error %q is missing the response of the token server", err)
+	}
+}
+
+func TestTag(t *testing.T) {
+	r := newFakeRegistry(t, true)
+	want := r.putManifest("team/app", "abc1234", testManifest)
+	c := r.client(t)
+
+	d, err := c.Tag(context.Background(), "team/app", "abc1234", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != want {
+		t.Errorf("tagged %s, want %s", d, want)
+	}
+	content, mediaType, d, err := c.GetManifest(context.Background(), "team/app", "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != want || mediaType != testManifest.mediaType || string(content) != string(testManifest.content) {
+		t.Errorf("retagged manifest = %s %s %s", d, mediaType, content)
+	}
+	if _, err := c.Tag(context.Background(), "team/app", "missing", "main"); err == nil {
+		t.Error("tagging a missing manifest succeeded")
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
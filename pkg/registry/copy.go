@@ -0,0 +1,145 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// descriptor is the part of a content descriptor needed to copy it
+type descriptor struct {
+	MediaType string        `json:"mediaType"`
+	Digest    digest.Digest `json:"digest"`
+	Size      int64         `json:"size"`
+}
+
+// manifestRefs holds the content referenced by an image manifest or an
+// index
+type manifestRefs struct {
+	Config    *descriptor  `json:"config"`
+	Layers    []descriptor `json:"layers"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+// Copy copies the manifest ref of a repository to tag in the destination
+// repository, together with the blobs and platform manifests the destination
+// is missing. The content is verified against its digest and the digest is
+// returned.
+func Copy(ctx context.Context, src *Client, srcRepository string, ref string, dst *Client, dstRepository string, tag string, out io.Writer) (string, error) {
+	d, err := copyManifest(ctx, src, srcRepository, ref, dst, dstRepository, tag, out)
+	if err != nil {
+		return "", err
+	}
+	return d.String(), nil
+}
+
+func copyManifest(ctx context.Context, src *Client, srcRepository string, ref string, dst *Client, dstRepository string, tag string, out io.Writer) (digest.Digest, error) {
+	manifest, mediaType, reported, err := src.GetManifest(ctx, srcRepository, ref)
+	if err != nil {
+		return "", err
+	}
+	computed := digest.FromBytes(manifest)
+	if expected, err := digest.Parse(ref); err == nil && expected != computed {
+		return "", fmt.Errorf("Digest mismatch for %s: got %s", ref, computed)
+	}
+	if reported != "" && reported != computed.String() {
+		return "", fmt.Errorf("Digest mismatch for %s:%s: registry reported %s, content is %s", srcRepository, ref, reported, computed)
+	}
+
+	refs := &manifestRefs{}
+	if err := json.Unmarshal(manifest, refs); err != nil {
+		return "", fmt.Errorf("Could not parse manifest %s: %s", computed, err)
+	}
+	switch mediaType {
+	case MediaTypeOCIIndex, MediaTypeDockerManifestList:
+		for _, m := range refs.Manifests {
+			if _, err := copyManifest(ctx, src, srcRepository, m.Digest.String(), dst, dstRepository, m.Digest.String(), out); err != nil {
+				return "", err
+			}
+		}
+	case MediaTypeOCIManifest, MediaTypeDockerManifest:
+		blobs := refs.Layers
+		if refs.Config != nil {
+			blobs = append([]descriptor{*refs.Config}, blobs...)
+		}
+		for _, blob := range blobs {
+			if err := copyBlob(ctx, src, srcRepository, dst, dstRepository, blob, out); err != nil {
+				return "", err
+			}
+		}
+	default:
+		return "", fmt.Errorf("Unsupported manifest type %s", mediaType)
+	}
+
+	pushed, err := dst.PutManifest(ctx, dstRepository, tag, mediaType, manifest)
+	if err != nil {
+		return "", err
+	}
+	if pushed != "" && pushed != computed.String() {
+		return "", fmt.Errorf("Digest mismatch after copy: %s reported %s, expected %s", dst.Host(), pushed, computed)
+	}
+	return computed, nil
+}
+
+// copyBlob copies a blob unless the destination has it, within one registry
+// the blob is mounted from the source repository
+func copyBlob(ctx context.Context, src *Client, srcRepository string, dst *Client, dstRepository string, blob descriptor, out io.Writer) error {
+	id := blob.Digest.Encoded()[:12]
+	exists, err := dst.BlobExists(ctx, dstRepository, blob.Digest.String())
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Fprintf(out, "%s: Layer already exists\n", id)
+		return nil
+	}
+	if src.host == dst.host {
+		mounted, err := dst.MountBlob(ctx, dstRepository, srcRepository, blob.Digest.String())
+		if err != nil {
+			return err
+		}
+		if mounted {
+			fmt.Fprintf(out, "%s: Mounted from %s\n", id, srcRepository)
+			return nil
+		}
+	}
+	open := func() (io.ReadCloser, error) {
+		return src.GetBlob(ctx, srcRepository, blob.Digest.String())
+	}
+	if err := dst.PutBlob(ctx, dstRepository, blob.Digest.String(), blob.Size, open); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s: Copied\n", id)
+	return nil
+}
+
+// MountBlob asks the registry to link a blob of another repository, mounted
+// is false when the registry does not support it or the blob is not
+// accessible. The token covers pulling from the source repository, without
+// it registries refuse the mount.
+func (c *Client) MountBlob(ctx context.Context, repository string, from string, digest string) (bool, error) {
+	path := fmt.Sprintf("/v2/%s/blobs/uploads/?mount=%s&from=%s", repository, digest, from)
+	scope := repositoryScope(repository, "pull,push") + " " + repositoryScope(from, "pull")
+	resp, err := c.doScope(ctx, http.MethodPost, scope, path, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusAccepted:
+		// the registry started a regular upload instead, cancel it
+		if location, err := c.location(resp); err == nil {
+			if cancel, err := c.doScope(ctx, http.MethodDelete, scope, location.RequestURI(), nil, nil); err == nil {
+				cancel.Body.Close()
+			}
+		}
+		return false, nil
+	}
+	return false, responseError(resp, fmt.Sprintf("mount %s from %s", digest, from))
+}
@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+func TestMountBlob(t *testing.T) {
+	for _, tokens := range []bool{false, true} {
+		r := newFakeRegistry(t, tokens)
+		blob := digest.FromString("layer").String()
+		r.blobs["team/base@"+blob] = true
+		c := r.client(t)
+
+		mounted, err := c.MountBlob(context.Background(), "team/app", "team/base", blob)
+		if err != nil || !mounted {
+			t.Errorf("tokens %v: mount = %v %v, want mounted", tokens, mounted, err)
+		}
+		if !r.blobs["team/app@"+blob] {
+			t.Errorf("tokens %v: blob not in the destination", tokens)
+		}
+		mounted, err = c.MountBlob(context.Background(), "team/app", "team/base", digest.FromString("missing").String())
+		if err != nil || mounted {
+			t.Errorf("tokens %v: mount of a missing blob = %v %v", tokens, mounted, err)
+		}
+	}
+}
+
+func TestPutBlobRenewsExpiredToken(t *testing.T) {
+	r := newFakeRegistry(t, true)
+	r.expirePuts = 1
+	c := r.client(t)
+	content := []byte("layer")
+	blob := digest.FromBytes(content).String()
+	opened := 0
+	open := func() (io.ReadCloser, error) {
+		opened++
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	}
+
+	if err := c.PutBlob(context.Background(), "team/app", blob, int64(len(content)), open); err != nil {
+		t.Fatal(err)
+	}
+	if !r.blobs["team/app@"+blob] {
+		t.Error("blob not uploaded")
+	}
+	if opened != 2 {
+		t.Errorf("content opened %d times, want 2", opened)
+	}
+
+	r.expirePuts = 2
+	if err := c.PutBlob(context.Background(), "team/app", blob, int64(len(content)), open); err == nil {
+		t.Error("upload refused twice succeeded")
+	}
+}
@@ -0,0 +1,178 @@
+package sbom
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// buildInfoMagic starts the .go.buildinfo section of Go binaries
+var buildInfoMagic = []byte("\xff Go buildinf:")
+
+const buildInfoHeaderSize = 32
+
+// goPackages returns the main module and the dependencies of a Go binary,
+// files that are not ELF binaries built with module support return nothing
+func goPackages(r io.Reader) ([]Package, error) {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != elf.ELFMAG {
+		return nil, nil
+	}
+	rest, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	f, err := elf.NewFile(bytes.NewReader(append(magic, rest...)))
+	if err != nil {
+		return nil, nil
+	}
+	goVersion, modInfo, err := readBuildInfo(f)
+	if err != nil || modInfo == "" {
+		return nil, err
+	}
+	return parseModInfo(goVersion, modInfo), nil
+}
+
+// readBuildInfo returns the Go version and module info embedded by the
+// linker, see debug/buildinfo in the standard library for the format
+func readBuildInfo(f *elf.File) (string, string, error) {
+	data := buildInfoData(f)
+	if data == nil {
+		return "", "", nil
+	}
+	ptrSize := int(data[14])
+	flags := data[15]
+	if flags&0x2 != 0 {
+		// since go 1.18 the strings follow the header
+		data = data[buildInfoHeaderSize:]
+		version, data := varintString(data)
+		modInfo, _ := varintString(data)
+		return version, trimModInfo(modInfo), nil
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if flags&0x1 != 0 {
+		order = binary.BigEndian
+	}
+	if ptrSize != 4 && ptrSize != 8 {
+		return "", "", fmt.Errorf("Invalid pointer size in Go build info: %d", ptrSize)
+	}
+	readPtr := func(b []byte) uint64 {
+		if ptrSize == 4 {
+			return uint64(order.Uint32(b))
+		}
+		return order.Uint64(b)
+	}
+	readString := func(ptr uint64) string {
+		header := readAt(f, ptr, 2*ptrSize)
+		if len(header) < 2*ptrSize {
+			return ""
+		}
+		return string(readAt(f, readPtr(header), int(readPtr(header[ptrSize:]))))
+	}
+	version := readString(readPtr(data[16:]))
+	modInfo := readString(readPtr(data[16+ptrSize:]))
+	return version, trimModInfo(modInfo), nil
+}
+
+// buildInfoData returns the build info header and the data following it,
+// nil for binaries that are not built with Go
+func buildInfoData(f *elf.File) []byte {
+	if section := f.Section(".go.buildinfo"); section != nil {
+		data, err := section.Data()
+		if err == nil && len(data) >= buildInfoHeaderSize && bytes.HasPrefix(data, buildInfoMagic) {
+			return data
+		}
+	}
+	// stripped binaries keep the header aligned in the writable data
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD || prog.Flags&elf.PF_W == 0 {
+			continue
+		}
+		data, err := ioutil.ReadAll(prog.Open())
+		if err != nil {
+			continue
+		}
+		for i := 0; i+buildInfoHeaderSize <= len(data); i += 16 {
+			if bytes.HasPrefix(data[i:], buildInfoMagic) {
+				return data[i:]
+			}
+		}
+	}
+	return nil
+}
+
+// readAt reads size bytes at a virtual address
+func readAt(f *elf.File, addr uint64, size int) []byte {
+	if size <= 0 || size > maxBinarySize {
+		return nil
+	}
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD || addr < prog.Vaddr || addr+uint64(size) > prog.Vaddr+prog.Filesz {
+			continue
+		}
+		b := make([]byte, size)
+		if _, err := prog.ReadAt(b, int64(addr-prog.Vaddr)); err != nil {
+			return nil
+		}
+		return b
+	}
+	return nil
+}
+
+func varintString(data []byte) (string, []byte) {
+	n, size := binary.Uvarint(data)
+	if size <= 0 || uint64(len(data)-size) < n {
+		return "", nil
+	}
+	return string(data[size : size+int(n)]), data[size+int(n):]
+}
+
+// trimModInfo removes the sentinels around the module info
+func trimModInfo(modInfo string) string {
+	if len(modInfo) >= 33 && modInfo[len(modInfo)-17] == '\n' {
+		return modInfo[16 : len(modInfo)-16]
+	}
+	return ""
+}
+
+// parseModInfo returns the standard library, the main module and the
+// dependencies, replaced modules are reported with their replacement
+func parseModInfo(goVersion string, modInfo string) []Package {
+	packages := []Package{}
+	if strings.HasPrefix(goVersion, "go") {
+		packages = append(packages, Package{
+			Name:    "stdlib",
+			Version: strings.TrimPrefix(goVersion, "go"),
+			Type:    TypeGolang,
+		})
+	}
+	for _, line := range strings.Split(modInfo, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			continue
+		}
+		version := ""
+		if len(fields) > 2 && fields[2] != "(devel)" {
+			version = fields[2]
+		}
+		switch fields[0] {
+		case "mod", "dep":
+			packages = append(packages, Package{
+				Name:    fields[1],
+				Version: version,
+				Type:    TypeGolang,
+			})
+		case "=>":
+			if len(packages) > 0 {
+				packages[len(packages)-1].Name = fields[1]
+				packages[len(packages)-1].Version = version
+			}
+		}
+	}
+	return packages
+}
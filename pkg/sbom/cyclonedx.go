@@ -0,0 +1,101 @@
+package sbom
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+const cycloneDXVersion = "1.3"
+
+// cycloneDXDocument is the subset of the CycloneDX 1.3 JSON format
+// describing the packages of an image
+type cycloneDXDocument struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     []cycloneDXTool    `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTool struct {
+	Name string `json:"name"`
+}
+
+type cycloneDXComponent struct {
+	BOMRef     string              `json:"bom-ref,omitempty"`
+	Type       string              `json:"type"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	Licenses   []cycloneDXLicense  `json:"licenses,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXLicense struct {
+	Expression string `json:"expression"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func writeCycloneDX(w io.Writer, d *Document) error {
+	doc := cycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  cycloneDXVersion,
+		SerialNumber: serialNumber(d),
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: d.Created.UTC().Format(time.RFC3339),
+			Tools:     []cycloneDXTool{{Name: "dev-tool"}},
+			Component: cycloneDXComponent{
+				Type:    "container",
+				Name:    d.Image,
+				Version: d.Digest,
+			},
+		},
+		Components: []cycloneDXComponent{},
+	}
+	for i, p := range d.Packages {
+		component := cycloneDXComponent{
+			BOMRef:  fmt.Sprintf("package-%d", i),
+			Type:    "library",
+			Name:    p.Name,
+			Version: p.Version,
+			PURL:    p.PURL,
+			Properties: []cycloneDXProperty{{
+				Name:  "dev-tool:location",
+				Value: p.Location,
+			}},
+		}
+		if p.License != "" {
+			component.Licenses = []cycloneDXLicense{{Expression: p.License}}
+		}
+		doc.Components = append(doc.Components, component)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(doc)
+}
+
+// serialNumber returns a uuid urn derived from the image, the same image
+// gives the same serial number
+func serialNumber(d *Document) string {
+	sum := sha256.Sum256([]byte(d.Image + "@" + d.Digest))
+	// version 5 style, name based
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
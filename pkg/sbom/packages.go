@@ -0,0 +1,112 @@
+package sbom
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// parseDpkg reads a dpkg status file, only installed packages are returned
+func parseDpkg(r io.Reader) ([]Package, error) {
+	packages := []Package{}
+	fields := map[string]string{}
+	last := ""
+	flush := func() {
+		if fields["Package"] != "" && (fields["Status"] == "" || strings.HasSuffix(fields["Status"], " installed")) {
+			packages = append(packages, Package{
+				Name:    fields["Package"],
+				Version: fields["Version"],
+				Type:    TypeDeb,
+				Arch:    fields["Architecture"],
+			})
+		}
+		fields = map[string]string{}
+		last = ""
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case line[0] == ' ' || line[0] == '\t':
+			// continuation of the previous field, only descriptions use it
+			if last != "" {
+				fields[last] += "\n" + strings.TrimSpace(line)
+			}
+		default:
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			last = parts[0]
+			fields[last] = strings.TrimSpace(parts[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return packages, nil
+}
+
+// parseApk reads the apk installed database
+func parseApk(r io.Reader) ([]Package, error) {
+	packages := []Package{}
+	current := Package{Type: TypeApk}
+	flush := func() {
+		if current.Name != "" {
+			packages = append(packages, current)
+		}
+		current = Package{Type: TypeApk}
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if len(line) < 2 || line[1] != ':' {
+			continue
+		}
+		value := line[2:]
+		switch line[0] {
+		case 'P':
+			current.Name = value
+		case 'V':
+			current.Version = value
+		case 'A':
+			current.Arch = value
+		case 'L':
+			current.License = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return packages, nil
+}
+
+// parseOSRelease reads the distribution id and version from os-release
+func parseOSRelease(r io.Reader) (Distro, error) {
+	distro := Distro{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.Trim(parts[1], `"'`)
+		switch parts[0] {
+		case "ID":
+			distro.ID = value
+		case "VERSION_ID":
+			distro.Version = value
+		}
+	}
+	return distro, scanner.Err()
+}
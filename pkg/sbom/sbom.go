@@ -0,0 +1,243 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Package types found in images
+const (
+	TypeDeb    = "deb"
+	TypeApk    = "apk"
+	TypeGolang = "golang"
+)
+
+// maxBinarySize is the largest executable read to look for Go build info
+const maxBinarySize = 256 << 20
+
+const whiteoutPrefix = ".wh."
+
+// Package is a software package installed in an image
+type Package struct {
+	Name    string
+	Version string
+	// Type is deb, apk or golang
+	Type    string
+	Arch    string
+	License string
+	// Location is the file the package was found in
+	Location string
+	// PURL is the package url, set by Merge
+	PURL string
+}
+
+// Document is the bill of materials of an image
+type Document struct {
+	// Image is the reference of the image
+	Image string
+	// Digest is the manifest digest, set once the image is pushed, or the
+	// image id
+	Digest   string
+	Created  time.Time
+	Distro   Distro
+	Packages []Package
+}
+
+// Distro is the operating system of an image, read from os-release
+type Distro struct {
+	ID      string
+	Version string
+}
+
+// Layer holds what was found in one layer of an image
+type Layer struct {
+	files     map[string][]Package
+	distro    map[string]Distro
+	whiteouts []string
+	opaque    []string
+}
+
+// ScanLayer reads an uncompressed layer tar and collects the package
+// databases, Go binaries and whiteouts in it
+func ScanLayer(r io.Reader) (*Layer, error) {
+	layer := &Layer{
+		files:  map[string][]Package{},
+		distro: map[string]Distro{},
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return layer, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		dir, base := path.Split(name)
+		dir = strings.TrimSuffix(dir, "/")
+		switch {
+		case base == whiteoutPrefix+whiteoutPrefix+".opq":
+			layer.opaque = append(layer.opaque, dir)
+			continue
+		case strings.HasPrefix(base, whiteoutPrefix):
+			layer.whiteouts = append(layer.whiteouts, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+			continue
+		case hdr.Typeflag != tar.TypeReg:
+			continue
+		}
+
+		var packages []Package
+		switch {
+		case name == "var/lib/dpkg/status" || dir == "var/lib/dpkg/status.d":
+			packages, err = parseDpkg(tr)
+		case name == "lib/apk/db/installed":
+			packages, err = parseApk(tr)
+		case name == "etc/os-release" || name == "usr/lib/os-release":
+			distro, err := parseOSRelease(tr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", name, err)
+			}
+			layer.distro[name] = distro
+			continue
+		case hdr.Mode&0111 != 0 && hdr.Size > 4 && hdr.Size <= maxBinarySize:
+			packages, err = goPackages(tr)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		if len(packages) > 0 {
+			for i := range packages {
+				packages[i].Location = "/" + name
+			}
+			layer.files[name] = packages
+		}
+	}
+}
+
+// Merge applies the layers in order, honoring whiteouts, and returns the
+// packages of the resulting filesystem with their package urls
+func Merge(layers []*Layer) (Distro, []Package) {
+	files := map[string][]Package{}
+	distros := map[string]Distro{}
+	for _, layer := range layers {
+		for _, dir := range layer.opaque {
+			removeBelow(files, distros, dir)
+		}
+		for _, p := range layer.whiteouts {
+			delete(files, p)
+			delete(distros, p)
+			removeBelow(files, distros, p)
+		}
+		for name, packages := range layer.files {
+			files[name] = packages
+		}
+		for name, distro := range layer.distro {
+			distros[name] = distro
+		}
+	}
+
+	distro, ok := distros["etc/os-release"]
+	if !ok {
+		distro = distros["usr/lib/os-release"]
+	}
+	packages := []Package{}
+	for _, found := range files {
+		for _, p := range found {
+			p.PURL = purl(p, distro)
+			packages = append(packages, p)
+		}
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Type != packages[j].Type {
+			return packages[i].Type < packages[j].Type
+		}
+		if packages[i].Name != packages[j].Name {
+			return packages[i].Name < packages[j].Name
+		}
+		return packages[i].Location < packages[j].Location
+	})
+	return distro, packages
+}
+
+// Write writes the document in the given format, spdx or cyclonedx
+func (d *Document) Write(w io.Writer, format string) error {
+	switch format {
+	case "spdx":
+		return writeSPDX(w, d)
+	case "cyclonedx":
+		return writeCycloneDX(w, d)
+	}
+	return fmt.Errorf("Unknown SBOM format: %s", format)
+}
+
+// MediaType returns the media type of the format
+func MediaType(format string) string {
+	if format == "cyclonedx" {
+		return "application/vnd.cyclonedx+json"
+	}
+	return "application/spdx+json"
+}
+
+// Extension returns the file extension of the format
+func Extension(format string) string {
+	if format == "cyclonedx" {
+		return ".cdx.json"
+	}
+	return ".spdx.json"
+}
+
+func removeBelow(files map[string][]Package, distros map[string]Distro, dir string) {
+	prefix := dir + "/"
+	if dir == "" {
+		prefix = ""
+	}
+	for name := range files {
+		if strings.HasPrefix(name, prefix) {
+			delete(files, name)
+		}
+	}
+	for name := range distros {
+		if strings.HasPrefix(name, prefix) {
+			delete(distros, name)
+		}
+	}
+}
+
+// purl returns the package url of a package, see
+// https://github.com/package-url/purl-spec
+func purl(p Package, distro Distro) string {
+	var b bytes.Buffer
+	switch p.Type {
+	case TypeDeb, TypeApk:
+		namespace := distro.ID
+		if namespace == "" {
+			namespace = map[string]string{TypeDeb: "debian", TypeApk: "alpine"}[p.Type]
+		}
+		fmt.Fprintf(&b, "pkg:%s/%s/%s@%s", p.Type, namespace, p.Name, p.Version)
+		qualifiers := []string{}
+		if p.Arch != "" {
+			qualifiers = append(qualifiers, "arch="+p.Arch)
+		}
+		if distro.Version != "" {
+			qualifiers = append(qualifiers, fmt.Sprintf("distro=%s-%s", distro.ID, distro.Version))
+		}
+		if len(qualifiers) > 0 {
+			fmt.Fprintf(&b, "?%s", strings.Join(qualifiers, "&"))
+		}
+	case TypeGolang:
+		fmt.Fprintf(&b, "pkg:golang/%s", p.Name)
+		if p.Version != "" {
+			fmt.Fprintf(&b, "@%s", p.Version)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,372 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tarFile is an entry of a test layer, a mode with an executable bit marks a
+// binary
+type tarFile struct {
+	name    string
+	content string
+	mode    int64
+}
+
+// layer scans an in-memory layer tar with the files
+func layer(t *testing.T, files ...tarFile) *Layer {
+	t.Helper()
+	var b bytes.Buffer
+	tw := tar.NewWriter(&b)
+	for _, f := range files {
+		mode := f.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		hdr := &tar.Header{Name: f.name, Mode: mode, Size: int64(len(f.content)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(f.name, "/") {
+			hdr = &tar.Header{Name: f.name, Mode: 0755, Typeflag: tar.TypeDir}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	l, err := ScanLayer(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// describe returns type:name@version location of the packages
+func describe(packages []Package) []string {
+	result := []string{}
+	for _, p := range packages {
+		result = append(result, p.Type+":"+p.Name+"@"+p.Version+" "+p.Location)
+	}
+	return result
+}
+
+const (
+	dpkgStatus = "Package: libc6\nStatus: install ok installed\nVersion: 2.31-13\nArchitecture: amd64\n" +
+		"Description: GNU C Library\n shared libraries\n\n" +
+		"Package: removed\nStatus: deinstall ok config-files\nVersion: 1.0\n\n" +
+		"Package: tzdata\nStatus: install ok installed\nVersion: 2021a-1\nArchitecture: all\n"
+	apkInstalled  = "C:Q1abc=\nP:musl\nV:1.2.2-r0\nA:x86_64\nL:MIT\n\nP:busybox\nV:1.33.1-r3\nA:x86_64\nL:GPL-2.0-only\n"
+	debianRelease = "PRETTY_NAME=\"Debian GNU/Linux 11 (bullseye)\"\nID=debian\nVERSION_ID=\"11\"\n"
+	alpineRelease = "NAME=\"Alpine Linux\"\nID=alpine\nVERSION_ID=3.13.5\n"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers [][]tarFile
+		distro Distro
+		want   []string
+	}{
+		{
+			name: "dpkg status",
+			layers: [][]tarFile{{
+				{name: "etc/os-release", content: debianRelease},
+				{name: "var/lib/dpkg/status", content: dpkgStatus},
+			}},
+			distro: Distro{ID: "debian", Version: "11"},
+			want:   []string{"deb:libc6@2.31-13 /var/lib/dpkg/status", "deb:tzdata@2021a-1 /var/lib/dpkg/status"},
+		},
+		{
+			name: "dpkg status.d",
+			layers: [][]tarFile{{
+				{name: "var/lib/dpkg/status.d/base", content: "Package: base-files\nVersion: 11.1\nArchitecture: amd64\n"},
+				{name: "var/lib/dpkg/status.d/tzdata", content: "Package: tzdata\nVersion: 2021a-1\n"},
+			}},
+			want: []string{"deb:base-files@11.1 /var/lib/dpkg/status.d/base", "deb:tzdata@2021a-1 /var/lib/dpkg/status.d/tzdata"},
+		},
+		{
+			name: "apk database",
+			layers: [][]tarFile{{
+				{name: "usr/lib/os-release", content: alpineRelease},
+				{name: "lib/apk/db/installed", content: apkInstalled},
+			}},
+			distro: Distro{ID: "alpine", Version: "3.13.5"},
+			want:   []string{"apk:busybox@1.33.1-r3 /lib/apk/db/installed", "apk:musl@1.2.2-r0 /lib/apk/db/installed"},
+		},
+		{
+			name: "later layer replaces the database",
+			layers: [][]tarFile{
+				{{name: "var/lib/dpkg/status", content: dpkgStatus}},
+				{{name: "var/lib/dpkg/status", content: "Package: tzdata\nStatus: install ok installed\nVersion: 2021b-1\n"}},
+			},
+			want: []string{"deb:tzdata@2021b-1 /var/lib/dpkg/status"},
+		},
+		{
+			name: "whiteout",
+			layers: [][]tarFile{
+				{
+					{name: "etc/os-release", content: debianRelease},
+					{name: "var/lib/dpkg/status", content: dpkgStatus},
+				},
+				{
+					{name: "var/lib/dpkg/.wh.status"},
+					{name: "etc/.wh.os-release"},
+				},
+			},
+			want: []string{},
+		},
+		{
+			name: "whiteout of a directory",
+			layers: [][]tarFile{
+				{{name: "var/lib/dpkg/status.d/base", content: "Package: base-files\nVersion: 11.1\n"}},
+				{{name: "var/lib/dpkg/.wh.status.d"}},
+			},
+			want: []string{},
+		},
+		{
+			name: "opaque directory",
+			layers: [][]tarFile{
+				{
+					{name: "var/lib/dpkg/status", content: dpkgStatus},
+					{name: "lib/apk/db/installed", content: apkInstalled},
+				},
+				{
+					{name: "var/lib/dpkg/"},
+					{name: "var/lib/dpkg/.wh..wh..opq"},
+				},
+			},
+			want: []string{"apk:busybox@1.33.1-r3 /lib/apk/db/installed", "apk:musl@1.2.2-r0 /lib/apk/db/installed"},
+		},
+		{
+			name: "opaque directory with new content",
+			layers: [][]tarFile{
+				{{name: "var/lib/dpkg/status", content: dpkgStatus}},
+				{
+					{name: "var/lib/.wh..wh..opq"},
+					{name: "var/lib/dpkg/status", content: "Package: tzdata\nVersion: 2021b-1\n"},
+				},
+			},
+			want: []string{"deb:tzdata@2021b-1 /var/lib/dpkg/status"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layers := []*Layer{}
+			for _, files := range tt.layers {
+				layers = append(layers, layer(t, files...))
+			}
+			distro, packages := Merge(layers)
+			if distro != tt.distro {
+				t.Errorf("distro = %+v, want %+v", distro, tt.distro)
+			}
+			if got := describe(packages); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("packages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDpkg(t *testing.T) {
+	packages, err := parseDpkg(strings.NewReader(dpkgStatus))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Package{
+		{Name: "libc6", Version: "2.31-13", Type: TypeDeb, Arch: "amd64"},
+		{Name: "tzdata", Version: "2021a-1", Type: TypeDeb, Arch: "all"},
+	}
+	if !reflect.DeepEqual(packages, want) {
+		t.Errorf("packages = %+v, want %+v", packages, want)
+	}
+}
+
+func TestParseApk(t *testing.T) {
+	packages, err := parseApk(strings.NewReader(apkInstalled))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Package{
+		{Name: "musl", Version: "1.2.2-r0", Type: TypeApk, Arch: "x86_64", License: "MIT"},
+		{Name: "busybox", Version: "1.33.1-r3", Type: TypeApk, Arch: "x86_64", License: "GPL-2.0-only"},
+	}
+	if !reflect.DeepEqual(packages, want) {
+		t.Errorf("packages = %+v, want %+v", packages, want)
+	}
+}
+
+func TestPURL(t *testing.T) {
+	tests := []struct {
+		pkg    Package
+		distro Distro
+		want   string
+	}{
+		{
+			pkg:    Package{Name: "libc6", Version: "2.31-13", Type: TypeDeb, Arch: "amd64"},
+			distro: Distro{ID: "debian", Version: "11"},
+			want:   "pkg:deb/debian/libc6@2.31-13?arch=amd64&distro=debian-11",
+		},
+		{
+			pkg:  Package{Name: "libc6", Version: "2.31-13", Type: TypeDeb},
+			want: "pkg:deb/debian/libc6@2.31-13",
+		},
+		{
+			pkg:    Package{Name: "musl", Version: "1.2.2-r0", Type: TypeApk, Arch: "x86_64"},
+			distro: Distro{ID: "alpine", Version: "3.13.5"},
+			want:   "pkg:apk/alpine/musl@1.2.2-r0?arch=x86_64&distro=alpine-3.13.5",
+		},
+		{
+			pkg:  Package{Name: "github.com/spf13/cobra", Version: "v1.1.1", Type: TypeGolang},
+			want: "pkg:golang/github.com/spf13/cobra@v1.1.1",
+		},
+		{
+			pkg:  Package{Name: "github.com/cldmnky/dev-tool", Type: TypeGolang},
+			want: "pkg:golang/github.com/cldmnky/dev-tool",
+		},
+	}
+	for _, tt := range tests {
+		if got := purl(tt.pkg, tt.distro); got != tt.want {
+			t.Errorf("purl of %s = %s, want %s", tt.pkg.Name, got, tt.want)
+		}
+	}
+}
+
+func TestParseModInfo(t *testing.T) {
+	modInfo := "path\texample.com/app\n" +
+		"mod\texample.com/app\t(devel)\t\n" +
+		"dep\tgithub.com/spf13/cobra\tv1.1.1\th1:abc=\n" +
+		"dep\tgithub.com/old/lib\tv1.0.0\t\n" +
+		"=>\tgithub.com/fork/lib\tv1.0.1\th1:def=\n"
+	got := describe(parseModInfo("go1.15.2", modInfo))
+	want := []string{
+		"golang:stdlib@1.15.2 ",
+		"golang:example.com/app@ ",
+		"golang:github.com/spf13/cobra@v1.1.1 ",
+		"golang:github.com/fork/lib@v1.0.1 ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("packages = %v, want %v", got, want)
+	}
+}
+
+func TestGoBinary(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the test binary is only an ELF file on linux")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, packages := Merge([]*Layer{layer(t,
+		tarFile{name: "usr/local/bin/app", content: string(content), mode: 0755},
+		// not executable, not scanned
+		tarFile{name: "usr/local/lib/app", content: string(content)},
+	)})
+	found := map[string]Package{}
+	for _, p := range packages {
+		if p.Location != "/usr/local/bin/app" {
+			t.Errorf("package %s found in %s", p.Name, p.Location)
+		}
+		found[p.Name] = p
+	}
+	stdlib, ok := found["stdlib"]
+	if !ok || "go"+stdlib.Version != runtime.Version() {
+		t.Errorf("stdlib = %+v, want %s", stdlib, runtime.Version())
+	}
+	if p := found["github.com/cldmnky/dev-tool"]; p.PURL != "pkg:golang/github.com/cldmnky/dev-tool" {
+		t.Errorf("main module = %+v", p)
+	}
+}
+
+func testDocument() *Document {
+	distro, packages := Merge([]*Layer{{
+		files: map[string][]Package{
+			"lib/apk/db/installed": {{Name: "musl", Version: "1.2.2-r0", Type: TypeApk, License: "MIT", Location: "/lib/apk/db/installed"}},
+		},
+		distro: map[string]Distro{"etc/os-release": {ID: "alpine", Version: "3.13.5"}},
+	}})
+	return &Document{
+		Image:    "registry.example.com/team/app:abc1234",
+		Digest:   "sha256:" + strings.Repeat("a", 64),
+		Created:  time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+		Distro:   distro,
+		Packages: packages,
+	}
+}
+
+func TestWriteSPDX(t *testing.T) {
+	var b bytes.Buffer
+	if err := testDocument().Write(&b, "spdx"); err != nil {
+		t.Fatal(err)
+	}
+	doc := spdxDocument{}
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.SPDXVersion != spdxVersion || doc.CreationInfo.Created != "2021-06-01T12:00:00Z" {
+		t.Errorf("document = %s %s", doc.SPDXVersion, doc.CreationInfo.Created)
+	}
+	if len(doc.Packages) != 2 || len(doc.Relationships) != 2 {
+		t.Fatalf("%d packages and %d relationships, want the image and musl", len(doc.Packages), len(doc.Relationships))
+	}
+	musl := doc.Packages[1]
+	if musl.Name != "musl" || musl.LicenseDeclared != "MIT" || strings.ContainsAny(strings.TrimPrefix(musl.SPDXID, "SPDXRef-"), "/:@_") {
+		t.Errorf("package = %+v", musl)
+	}
+	if len(musl.ExternalRefs) != 1 || musl.ExternalRefs[0].ReferenceLocator != "pkg:apk/alpine/musl@1.2.2-r0?distro=alpine-3.13.5" {
+		t.Errorf("external refs = %+v", musl.ExternalRefs)
+	}
+	if r := doc.Relationships[1]; r.Element != doc.Packages[0].SPDXID || r.Type != "CONTAINS" || r.Related != musl.SPDXID {
+		t.Errorf("relationship = %+v", r)
+	}
+
+	var again bytes.Buffer
+	if err := testDocument().Write(&again, "spdx"); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != b.String() {
+		t.Error("the same image gave a different document")
+	}
+}
+
+func TestWriteCycloneDX(t *testing.T) {
+	var b bytes.Buffer
+	if err := testDocument().Write(&b, "cyclonedx"); err != nil {
+		t.Fatal(err)
+	}
+	doc := cycloneDXDocument{}
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.BOMFormat != "CycloneDX" || doc.SpecVersion != cycloneDXVersion || !strings.HasPrefix(doc.SerialNumber, "urn:uuid:") {
+		t.Errorf("document = %s %s %s", doc.BOMFormat, doc.SpecVersion, doc.SerialNumber)
+	}
+	if doc.Metadata.Component.Name != "registry.example.com/team/app:abc1234" {
+		t.Errorf("component = %+v", doc.Metadata.Component)
+	}
+	if len(doc.Components) != 1 {
+		t.Fatalf("%d components, want 1", len(doc.Components))
+	}
+	musl := doc.Components[0]
+	if musl.PURL != "pkg:apk/alpine/musl@1.2.2-r0?distro=alpine-3.13.5" || len(musl.Licenses) != 1 || musl.Licenses[0].Expression != "MIT" {
+		t.Errorf("component = %+v", musl)
+	}
+
+	if err := testDocument().Write(&b, "unknown"); err == nil {
+		t.Error("wrote an unknown format")
+	}
+}
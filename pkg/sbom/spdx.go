@@ -0,0 +1,128 @@
+package sbom
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+)
+
+const spdxVersion = "SPDX-2.2"
+
+// spdxDocument is the subset of the SPDX 2.2 JSON format describing the
+// packages of an image
+type spdxDocument struct {
+	SPDXID            string             `json:"SPDXID"`
+	SPDXVersion       string             `json:"spdxVersion"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Name              string             `json:"name"`
+	DataLicense       string             `json:"dataLicense"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	SourceInfo       string            `json:"sourceInfo,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+var spdxInvalid = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// spdxID returns an SPDX identifier, only letters, digits, dots and dashes
+// are allowed
+func spdxID(parts ...interface{}) string {
+	return "SPDXRef-" + spdxInvalid.ReplaceAllString(fmt.Sprint(parts...), "-")
+}
+
+func writeSPDX(w io.Writer, d *Document) error {
+	// the namespace has to be unique per document, the same image gives
+	// the same namespace
+	namespace := sha256.Sum256([]byte(d.Image + "@" + d.Digest))
+	image := spdxPackage{
+		SPDXID:           spdxID("Image"),
+		Name:             d.Image,
+		VersionInfo:      d.Digest,
+		DownloadLocation: "NOASSERTION",
+		LicenseConcluded: "NOASSERTION",
+		LicenseDeclared:  "NOASSERTION",
+		CopyrightText:    "NOASSERTION",
+	}
+	doc := spdxDocument{
+		SPDXID:      "SPDXRef-DOCUMENT",
+		SPDXVersion: spdxVersion,
+		CreationInfo: spdxCreationInfo{
+			Created:  d.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: dev-tool"},
+		},
+		Name:              d.Image,
+		DataLicense:       "CC0-1.0",
+		DocumentNamespace: fmt.Sprintf("https://github.com/cldmnky/dev-tool/sbom/%x", namespace),
+		Packages:          []spdxPackage{image},
+		Relationships: []spdxRelationship{{
+			Element: "SPDXRef-DOCUMENT",
+			Type:    "DESCRIBES",
+			Related: image.SPDXID,
+		}},
+	}
+	for i, p := range d.Packages {
+		license := "NOASSERTION"
+		if p.License != "" {
+			license = p.License
+		}
+		pkg := spdxPackage{
+			SPDXID:           spdxID("Package-", p.Type, "-", p.Name, "-", i),
+			Name:             p.Name,
+			VersionInfo:      p.Version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  license,
+			CopyrightText:    "NOASSERTION",
+			SourceInfo:       "found in " + p.Location,
+		}
+		if p.PURL != "" {
+			pkg.ExternalRefs = []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  p.PURL,
+			}}
+		}
+		doc.Packages = append(doc.Packages, pkg)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			Element: image.SPDXID,
+			Type:    "CONTAINS",
+			Related: pkg.SPDXID,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(doc)
+}